@@ -1,11 +1,17 @@
 package core
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
+	"strings"
 
 	ipfs_config "github.com/ipfs/kubo/config"
+	ipfs_common "github.com/ipfs/kubo/repo/common"
 )
 
+// Config是暴露给移动平台的IPFS配置
+// 配置项使用与`ipfs config`相同的点分路径访问，例如"Swarm.ConnMgr.HighWater"
 type Config struct {
 	cfg *ipfs_config.Config
 }
@@ -14,11 +20,135 @@ func (c *Config) getConfig() (cfg *ipfs_config.Config) {
 	return c.cfg
 }
 
+// NewDefaultConfig创建默认配置，使用Ed25519密钥生成新的身份
 func NewDefaultConfig() (*Config, error) {
-	cfg, err := initConfig(io.Discard, 2048)
+	return NewDefaultConfigWithKey(defaultKeyType, 0)
+}
+
+// NewDefaultConfigWithKey创建默认配置，使用给定类型的密钥生成新的身份
+// keyType为KeyTypeEd25519、KeyTypeECDSA、KeyTypeSecp256k1或KeyTypeRSA，为空时使用Ed25519
+// bits只用于RSA(密钥长度，至少2048)和ECDSA(曲线大小:256、384或521)，为0时使用默认值
+func NewDefaultConfigWithKey(keyType string, bits int) (*Config, error) {
+	cfg, err := initConfig(io.Discard, keyType, bits)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Config{cfg}, nil
 }
+
+// GetKey返回配置项的JSON值
+func (c *Config) GetKey(key string) ([]byte, error) {
+	return getConfigKey(c.cfg, key)
+}
+
+// SetKey将配置项设置为给定的JSON值，例如SetKey("Discovery.MDNS.Enabled", []byte("false"))
+func (c *Config) SetKey(key string, jsonValue []byte) error {
+	cfg, err := setConfigKey(c.cfg, key, jsonValue)
+	if err != nil {
+		return err
+	}
+
+	c.cfg = cfg
+	return nil
+}
+
+// ToJSON返回完整配置的JSON，与`ipfs config show`一样不包含私钥
+func (c *Config) ToJSON() ([]byte, error) {
+	return configToJSON(c.cfg)
+}
+
+// FromJSON用JSON替换整个配置，与`ipfs config replace`一样保留当前的私钥
+func (c *Config) FromJSON(data []byte) error {
+	cfg, err := configFromJSON(c.cfg, data)
+	if err != nil {
+		return err
+	}
+
+	c.cfg = cfg
+	return nil
+}
+
+// checkConfigKey检查配置项是否存在，与`ipfs config`一样，私钥和包含私钥的Identity不能通过配置接口读写
+func checkConfigKey(key string) error {
+	if strings.EqualFold(key, ipfs_config.IdentityTag) || strings.EqualFold(key, ipfs_config.PrivKeySelector) {
+		return fmt.Errorf("cannot show or change private key through API")
+	}
+
+	return ipfs_config.CheckKey(key)
+}
+
+func getConfigKey(cfg *ipfs_config.Config, key string) ([]byte, error) {
+	if err := checkConfigKey(key); err != nil {
+		return nil, err
+	}
+
+	m, err := ipfs_config.ToMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := ipfs_common.MapGetKV(m, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// setConfigKey返回设置了配置项的新配置，cfg本身不会被修改
+func setConfigKey(cfg *ipfs_config.Config, key string, jsonValue []byte) (*ipfs_config.Config, error) {
+	if err := checkConfigKey(key); err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(jsonValue, &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON value for `%s`: %w", key, err)
+	}
+
+	m, err := ipfs_config.ToMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ipfs_common.MapSetKV(m, key, v); err != nil {
+		return nil, err
+	}
+
+	// 转换回结构体的同时校验值的类型
+	newCfg, err := ipfs_config.FromMap(m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for `%s`: %w", key, err)
+	}
+
+	return newCfg, nil
+}
+
+func configToJSON(cfg *ipfs_config.Config) ([]byte, error) {
+	m, err := ipfs_config.ToMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity, ok := m[ipfs_config.IdentityTag].(map[string]interface{}); ok {
+		delete(identity, ipfs_config.PrivKeyTag)
+	}
+
+	return ipfs_config.Marshal(m)
+}
+
+// configFromJSON解析JSON配置并保留cfg中的私钥
+func configFromJSON(cfg *ipfs_config.Config, data []byte) (*ipfs_config.Config, error) {
+	var newCfg ipfs_config.Config
+	if err := json.Unmarshal(data, &newCfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if newCfg.Identity.PrivKey != "" {
+		return nil, fmt.Errorf("setting private key with API is not supported")
+	}
+
+	newCfg.Identity.PrivKey = cfg.Identity.PrivKey
+	return &newCfg, nil
+}
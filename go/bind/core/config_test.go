@@ -0,0 +1,157 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConfigKey(t *testing.T) {
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.SetKey("Swarm.ConnMgr.HighWater", []byte("42")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := cfg.GetKey("Swarm.ConnMgr.HighWater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "42" {
+		t.Fatalf("Swarm.ConnMgr.HighWater = %s", v)
+	}
+
+	v, err = cfg.GetKey("Identity.PeerID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	if err := json.Unmarshal(v, &id); err != nil || id == "" {
+		t.Fatalf("Identity.PeerID = %s", v)
+	}
+
+	for _, c := range []struct {
+		key   string
+		value string
+	}{
+		{"Swarm.ConnMgr.HighWater", "not json"}, // 非法的JSON
+		{"Swarm.ConnMgr.HighWater", `"many"`},   // 类型不匹配
+		{"Identity.PrivKey", `"key"`},           // 私钥不能修改
+		{"Identity", `{"PeerID": "", "PrivKey": "key"}`},
+		{"identity", `{}`},
+	} {
+		if err := cfg.SetKey(c.key, []byte(c.value)); err == nil {
+			t.Errorf("SetKey(%s, %s) should fail", c.key, c.value)
+		}
+	}
+
+	// 失败的修改不影响原来的配置
+	if v, _ := cfg.GetKey("Swarm.ConnMgr.HighWater"); string(v) != "42" {
+		t.Fatalf("Swarm.ConnMgr.HighWater = %s after failed SetKey", v)
+	}
+
+	for _, key := range []string{"Identity", "identity", "Identity.PrivKey", "identity.privkey", "Swarm.NoSuchKey"} {
+		if _, err := cfg.GetKey(key); err == nil {
+			t.Errorf("GetKey(%s) should fail", key)
+		}
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := cfg.getConfig().Identity.PrivKey
+
+	data, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "PrivKey") {
+		t.Fatal("exported config contains the private key")
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	m["Bootstrap"] = []string{}
+	data, err = json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.FromJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := cfg.GetKey("Bootstrap"); string(v) != "[]" {
+		t.Fatalf("Bootstrap = %s", v)
+	}
+	if cfg.getConfig().Identity.PrivKey != privKey {
+		t.Fatal("private key not kept")
+	}
+
+	if err := cfg.FromJSON([]byte("{")); err == nil {
+		t.Fatal("importing invalid JSON should fail")
+	}
+	if err := cfg.FromJSON([]byte(`{"Identity": {"PrivKey": "key"}}`)); err == nil {
+		t.Fatal("importing a private key should fail")
+	}
+}
+
+func TestRepoConfigKey(t *testing.T) {
+	path := t.TempDir()
+	if err := InitRepo(path, newTestConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SetConfigKey("Swarm.ConnMgr.LowWater", []byte("7")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetConfigKey("Swarm.ConnMgr.LowWater", []byte(`"seven"`)); err == nil {
+		t.Fatal("setting a value of the wrong type should fail")
+	}
+	if _, err := r.GetConfigKey("Identity"); err == nil {
+		t.Fatal("reading the identity should fail")
+	}
+	if err := r.SetConfigKey("Identity", []byte(`{}`)); err == nil {
+		t.Fatal("replacing the identity should fail")
+	}
+
+	data, err := r.GetConfigJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetConfigJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetConfigJSON([]byte("{")); err == nil {
+		t.Fatal("importing invalid JSON should fail")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改已写入仓库
+	r, err = OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	v, err := r.GetConfigKey("Swarm.ConnMgr.LowWater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "7" {
+		t.Fatalf("Swarm.ConnMgr.LowWater = %s", v)
+	}
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// AddResult是添加内容的结果
+type AddResult struct {
+	Cid  string // 根节点CID
+	Size int64  // 添加的内容字节数
+}
+
+// StatResult描述一个IPFS对象
+type StatResult struct {
+	Cid            string // 根节点CID
+	Type           string // "file"、"directory"或"symlink"
+	Size           int64  // 文件内容大小，目录为累计大小
+	CumulativeSize int64  // 包含所有子节点在内的DAG大小
+	BlockSize      int64  // 根节点块大小
+	NumLinks       int    // 根节点的链接数量
+}
+
+// LsEntry是目录列表中的一项
+type LsEntry struct {
+	Name string
+	Cid  string
+	Type string // "file"、"directory"、"symlink"或"unknown"
+	Size int64
+}
+
+// LsResult是目录列表，gomobile无法绑定结构体切片，因此通过下标访问
+type LsResult struct {
+	entries []*LsEntry
+}
+
+// Count返回目录项数量
+func (r *LsResult) Count() int {
+	return len(r.entries)
+}
+
+// Get返回第i个目录项，越界时返回nil
+func (r *LsResult) Get(i int) *LsEntry {
+	if i < 0 || i >= len(r.entries) {
+		return nil
+	}
+
+	return r.entries[i]
+}
+
+// AddBytes将数据作为文件添加到IPFS，pin为true时固定添加的内容
+func (n *Node) AddBytes(data []byte, pin bool) (*AddResult, error) {
+	// gomobile传入的切片在调用返回后可能失效，这里复制一份
+	b := make([]byte, len(data))
+	copy(b, data)
+
+	return n.add(files.NewReaderFile(bytes.NewReader(b)), int64(len(b)), pin)
+}
+
+// AddFile将本地文件或目录添加到IPFS，pin为true时固定添加的内容
+func (n *Node) AddFile(filePath string, pin bool) (*AddResult, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := files.NewSerialFile(filePath, false, stat)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open `%s`: %w", filePath, err)
+	}
+	defer node.Close()
+
+	size, err := node.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	return n.add(node, size, pin)
+}
+
+func (n *Node) add(node files.Node, size int64, pin bool) (*AddResult, error) {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	// 剩余空间不足时存储看门狗会拒绝添加
+	if n.storage.rejectAdds.Load() {
+		return nil, errInsufficientStorage
+	}
+
+	// 写入前检查存储配额，超过StorageMax时拒绝添加
+	if err := n.reserveStorage(size); err != nil {
+		return nil, err
+	}
+
+	p, err := api.Unixfs().Add(withLocalWrites(n.ctx), node, options.Unixfs.Pin(pin))
+	if err != nil {
+		return nil, fmt.Errorf("unable to add content: %w", err)
+	}
+
+	return &AddResult{
+		Cid:  p.RootCid().String(),
+		Size: size,
+	}, nil
+}
+
+// Cat读取文件内容，从offset开始最多读取length个字节
+// length小于等于0时读取到文件末尾，大文件应使用NewRequest("cat").SendStream
+// timeoutMs是等待网络上的内容的时限，单位为毫秒，小于等于0时不超时
+func (n *Node) Cat(cid string, offset int64, length int64, timeoutMs int64) ([]byte, error) {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := contentPath(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := n.contentContext(timeoutMs)
+	defer cancel()
+
+	node, err := api.Unixfs().Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer node.Close()
+
+	f, ok := node.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("`%s` is not a file", cid)
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("unable to seek to %d: %w", offset, err)
+		}
+	}
+
+	var r io.Reader = f
+	if length > 0 {
+		r = io.LimitReader(f, length)
+	}
+
+	return io.ReadAll(r)
+}
+
+// Ls列出目录的内容，timeoutMs与Cat相同
+func (n *Node) Ls(cid string, timeoutMs int64) (*LsResult, error) {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := contentPath(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := n.contentContext(timeoutMs)
+	defer cancel()
+
+	res := &LsResult{entries: []*LsEntry{}}
+	for entry, err := range coreiface.LsIter(ctx, api.Unixfs(), p, options.Unixfs.ResolveChildren(true)) {
+		if err != nil {
+			return nil, err
+		}
+
+		res.entries = append(res.entries, &LsEntry{
+			Name: entry.Name,
+			Cid:  entry.Cid.String(),
+			Type: entry.Type.String(),
+			Size: int64(entry.Size),
+		})
+	}
+
+	return res, nil
+}
+
+// Pin固定内容，recursive为true时固定整个DAG
+// timeoutMs是获取网络上的内容的时限，单位为毫秒，小于等于0时不超时
+func (n *Node) Pin(cid string, recursive bool, timeoutMs int64) error {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return err
+	}
+
+	p, err := contentPath(cid)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := n.contentContext(timeoutMs)
+	defer cancel()
+
+	return api.Pin().Add(ctx, p, options.Pin.Recursive(recursive))
+}
+
+// Unpin取消固定内容，recursive需要与固定时一致
+func (n *Node) Unpin(cid string, recursive bool) error {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return err
+	}
+
+	p, err := contentPath(cid)
+	if err != nil {
+		return err
+	}
+
+	return api.Pin().Rm(n.ctx, p, options.Pin.RmRecursive(recursive))
+}
+
+// Stat返回对象的基本信息，timeoutMs与Cat相同
+func (n *Node) Stat(cid string, timeoutMs int64) (*StatResult, error) {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := contentPath(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := n.contentContext(timeoutMs)
+	defer cancel()
+
+	nd, err := api.ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	cumulative, err := nd.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := api.Unixfs().Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer node.Close()
+
+	size, err := node.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &StatResult{
+		Cid:            nd.Cid().String(),
+		Size:           size,
+		CumulativeSize: int64(cumulative),
+		BlockSize:      int64(len(nd.RawData())),
+		NumLinks:       len(nd.Links()),
+	}
+
+	switch node.(type) {
+	case files.Directory:
+		res.Type = coreiface.TDirectory.String()
+	case *files.Symlink:
+		res.Type = coreiface.TSymlink.String()
+	default:
+		res.Type = coreiface.TFile.String()
+	}
+
+	return res, nil
+}
+
+// contentPath将CID或/ipfs/、/ipns/路径转换为path.Path
+func contentPath(s string) (path.Path, error) {
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + path.IPFSNamespace + "/" + s
+	}
+
+	p, err := path.NewPath(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path `%s`: %w", s, err)
+	}
+
+	return p, nil
+}
+
+// contentContext返回读取内容使用的上下文，timeoutMs小于等于0时不超时，节点关闭时总会取消
+func (n *Node) contentContext(timeoutMs int64) (context.Context, context.CancelFunc) {
+	if timeoutMs <= 0 {
+		return context.WithCancel(n.ctx)
+	}
+
+	return context.WithTimeout(n.ctx, time.Duration(timeoutMs)*time.Millisecond)
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddBytesCat(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	data := []byte("0123456789")
+	res, err := n.AddBytes(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Size != int64(len(data)) {
+		t.Fatalf("Size = %d", res.Size)
+	}
+
+	// 修改传入的切片不影响已添加的内容
+	data[0] = 'x'
+
+	for _, c := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 0, "0123456789"},
+		{3, 0, "3456789"},
+		{3, 4, "3456"},
+		{8, 10, "89"},
+	} {
+		got, err := n.Cat(res.Cid, c.offset, c.length, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("Cat(%d, %d) = %q, want %q", c.offset, c.length, got, c.want)
+		}
+	}
+
+	if _, err := n.Cat("/ipfs/"+res.Cid, 0, 0, 0); err != nil {
+		t.Fatalf("Cat with an /ipfs/ path: %v", err)
+	}
+
+	st, err := n.Stat(res.Cid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Type != "file" || st.Size != 10 || st.Cid != res.Cid {
+		t.Fatalf("unexpected stat: %+v", st)
+	}
+}
+
+func TestAddFileLs(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aaa"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := n.AddFile(filepath.Join(dir, "a.txt"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Size != 3 {
+		t.Fatalf("Size = %d", file.Size)
+	}
+
+	res, err := n.AddFile(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls, err := n.Ls(res.Cid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Count() != 2 {
+		t.Fatalf("Ls returned %d entries", ls.Count())
+	}
+	if e := ls.Get(0); e.Name != "a.txt" || e.Type != "file" || e.Cid != file.Cid || e.Size != 3 {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e := ls.Get(1); e.Name != "sub" || e.Type != "directory" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if ls.Get(2) != nil {
+		t.Fatal("out of range entry should be nil")
+	}
+
+	st, err := n.Stat(res.Cid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Type != "directory" || st.NumLinks != 2 {
+		t.Fatalf("unexpected stat: %+v", st)
+	}
+
+	if _, err := n.Cat(res.Cid, 0, 0, 0); err == nil {
+		t.Fatal("Cat on a directory should fail")
+	}
+}
+
+func TestPinUnpin(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	res, err := n.AddBytes(randomBytes(t, 1024), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Unpin(res.Cid, true); err == nil {
+		t.Fatal("unpinning content that is not pinned should fail")
+	}
+	if err := n.Pin(res.Cid, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Unpin(res.Cid, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContentErrors(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if _, err := n.AddFile(filepath.Join(t.TempDir(), "missing"), true); err == nil {
+		t.Fatal("adding a missing file should fail")
+	}
+
+	for name, fn := range map[string]func() error{
+		"Cat":   func() error { _, err := n.Cat("not-a-cid", 0, 0, 0); return err },
+		"Ls":    func() error { _, err := n.Ls("not-a-cid", 0); return err },
+		"Stat":  func() error { _, err := n.Stat("not-a-cid", 0); return err },
+		"Pin":   func() error { return n.Pin("not-a-cid", true, 0) },
+		"Unpin": func() error { return n.Unpin("not-a-cid", true) },
+	} {
+		if err := fn(); err == nil {
+			t.Errorf("%s with an invalid CID should fail", name)
+		}
+	}
+}
+
+func TestContentTimeout(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	// 没有节点提供的内容
+	b := newTestNode(t, nil)
+	res, err := b.AddBytes(randomBytes(t, 1024), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fn := range map[string]func() error{
+		"Cat":  func() error { _, err := n.Cat(res.Cid, 0, 0, 200); return err },
+		"Ls":   func() error { _, err := n.Ls(res.Cid, 200); return err },
+		"Stat": func() error { _, err := n.Stat(res.Cid, 200); return err },
+		"Pin":  func() error { return n.Pin(res.Cid, true, 200) },
+	} {
+		start := time.Now()
+		if err := fn(); err == nil {
+			t.Errorf("%s of unavailable content should time out", name)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s returned after %s", name, d)
+		}
+	}
+}
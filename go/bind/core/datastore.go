@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+
+	ipfs_fsrepo "github.com/ipfs/kubo/repo/fsrepo"
+)
+
+// 数据存储profile，只能在InitRepo之前通过Config.SetDatastoreProfile选择
+const (
+	// DatastoreProfileFlatfs是默认的数据存储: 块保存在flatfs中(每次写入都同步到磁盘)，其他数据保存在leveldb中
+	DatastoreProfileFlatfs = "flatfs"
+	// DatastoreProfileFlatfsNoSync与flatfs相同，但写入块时不同步到磁盘，速度更快，系统崩溃时可能丢失最近写入的块
+	DatastoreProfileFlatfsNoSync = "flatfs-nosync"
+	// DatastoreProfilePebble把所有数据保存在pebble中，适合大量小块
+	DatastoreProfilePebble = "pebbleds"
+	// DatastoreProfileBadger把所有数据保存在badger中，内存占用较高
+	DatastoreProfileBadger = "badgerds"
+)
+
+var datastoreProfiles = map[string]func() map[string]interface{}{
+	DatastoreProfileFlatfs:       func() map[string]interface{} { return flatfsDatastoreSpec(true) },
+	DatastoreProfileFlatfsNoSync: func() map[string]interface{} { return flatfsDatastoreSpec(false) },
+	DatastoreProfilePebble:       pebbleDatastoreSpec,
+	DatastoreProfileBadger:       badgerDatastoreSpec,
+}
+
+// SetDatastoreProfile选择仓库使用的数据存储，name为DatastoreProfileFlatfs等常量
+// 只对之后的InitRepo有效，已有仓库的数据存储不能更换
+func (c *Config) SetDatastoreProfile(name string) error {
+	spec, ok := datastoreProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown datastore profile `%s`", name)
+	}
+
+	c.cfg.Datastore.Spec = spec()
+	return nil
+}
+
+// checkDatastorePlugins确认数据存储用到的所有后端都已由loadPlugins注册
+// 后端没有编译进来(或在配置的Plugins中被禁用)时返回错误，避免留下初始化了一半的仓库
+func checkDatastorePlugins(spec map[string]interface{}) error {
+	if _, err := ipfs_fsrepo.AnyDatastoreConfig(spec); err != nil {
+		return fmt.Errorf("datastore is not supported by this build: %w", err)
+	}
+
+	return nil
+}
+
+func flatfsDatastoreSpec(sync bool) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "mount",
+		"mounts": []interface{}{
+			map[string]interface{}{
+				"mountpoint": "/blocks",
+				"type":       "measure",
+				"prefix":     "flatfs.datastore",
+				"child": map[string]interface{}{
+					"type":      "flatfs",
+					"path":      "blocks",
+					"sync":      sync,
+					"shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+				},
+			},
+			map[string]interface{}{
+				"mountpoint": "/",
+				"type":       "measure",
+				"prefix":     "leveldb.datastore",
+				"child": map[string]interface{}{
+					"type":        "levelds",
+					"path":        "datastore",
+					"compression": "none",
+				},
+			},
+		},
+	}
+}
+
+func pebbleDatastoreSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "measure",
+		"prefix": "pebble.datastore",
+		"child": map[string]interface{}{
+			"type": "pebbleds",
+			"path": "pebbleds",
+		},
+	}
+}
+
+func badgerDatastoreSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "measure",
+		"prefix": "badger.datastore",
+		"child": map[string]interface{}{
+			"type":       "badgerds",
+			"path":       "badgerds",
+			"syncWrites": false,
+			"truncate":   true,
+		},
+	}
+}
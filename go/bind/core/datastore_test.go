@@ -0,0 +1,77 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDatastoreProfiles(t *testing.T) {
+	for _, profile := range []string{
+		DatastoreProfileFlatfs,
+		DatastoreProfileFlatfsNoSync,
+		DatastoreProfilePebble,
+		DatastoreProfileBadger,
+	} {
+		t.Run(profile, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			if err := cfg.SetDatastoreProfile(profile); err != nil {
+				t.Fatal(err)
+			}
+
+			n := newTestNode(t, cfg)
+			res, err := n.AddBytes([]byte("datastore "+profile), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err := n.Cat(res.Cid, 0, 0, 0); err != nil || string(data) != "datastore "+profile {
+				t.Fatalf("Cat = %q, %v", data, err)
+			}
+
+			// 仓库记录了选择的数据存储
+			spec, err := os.ReadFile(filepath.Join(n.repo.mr.Path(), "datastore_spec"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.TrimSuffix(profile, "-nosync")
+			if !strings.Contains(string(spec), `"`+want+`"`) {
+				t.Fatalf("datastore_spec = %s", spec)
+			}
+
+			if profile == DatastoreProfileFlatfsNoSync {
+				v, err := n.repo.GetConfigKey("Datastore.Spec")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(v), `"sync":false`) {
+					t.Fatalf("Datastore.Spec = %s", v)
+				}
+			}
+		})
+	}
+}
+
+func TestDatastoreProfileErrors(t *testing.T) {
+	cfg := newTestConfig(t)
+	if err := cfg.SetDatastoreProfile("nosuchds"); err == nil {
+		t.Fatal("selecting an unknown profile should fail")
+	}
+
+	// 没有编译进来的后端
+	spec := `{"type": "measure", "prefix": "test", "child": {"type": "nosuchds", "path": "nosuchds"}}`
+	if err := cfg.SetKey("Datastore.Spec", []byte(spec)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir()
+	err := InitRepo(path, cfg)
+	if err == nil || !strings.Contains(err.Error(), "not supported by this build") {
+		t.Fatalf("InitRepo with an unsupported datastore = %v", err)
+	}
+
+	// 没有留下初始化了一半的仓库
+	if _, err := os.Stat(filepath.Join(path, "config")); !os.IsNotExist(err) {
+		t.Fatalf("config written for a failed init: %v", err)
+	}
+}
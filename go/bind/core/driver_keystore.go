@@ -0,0 +1,110 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// NativeKeystoreDriver由原生平台实现，用于把私钥保存在iOS Keychain或Android Keystore中
+// alias是密钥的名称，LoadSecret在密钥不存在时返回nil，DeleteSecret删除不存在的密钥时不返回错误
+type NativeKeystoreDriver interface {
+	StoreSecret(alias string, secret []byte) error
+	LoadSecret(alias string) ([]byte, error)
+	DeleteSecret(alias string) error
+}
+
+// SoftwareKeystoreDriver是使用AES-GCM加密文件的NativeKeystoreDriver实现
+// 用于没有系统密钥库的平台(如Linux上的测试)，加密密钥由调用方保管
+type SoftwareKeystoreDriver struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+var _ NativeKeystoreDriver = (*SoftwareKeystoreDriver)(nil)
+
+// NewSoftwareKeystoreDriver创建把密钥加密保存在dir目录中的驱动
+// key是AES密钥，长度必须为16、24或32字节
+func NewSoftwareKeystoreDriver(dir string, key []byte) (*SoftwareKeystoreDriver, error) {
+	block, err := aes.NewCipher(append([]byte{}, key...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create keystore directory: %w", err)
+	}
+
+	return &SoftwareKeystoreDriver{dir: dir, aead: aead}, nil
+}
+
+// StoreSecret加密并保存密钥，已存在时覆盖
+func (d *SoftwareKeystoreDriver) StoreSecret(alias string, secret []byte) error {
+	nonce := make([]byte, d.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	// alias作为附加数据，防止密钥文件被互相替换
+	data := d.aead.Seal(nonce, nonce, secret, []byte(alias))
+
+	path := d.path(alias)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("unable to store secret: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to store secret: %w", err)
+	}
+
+	return nil
+}
+
+// LoadSecret读取并解密密钥，不存在时返回nil
+func (d *SoftwareKeystoreDriver) LoadSecret(alias string) ([]byte, error) {
+	data, err := os.ReadFile(d.path(alias))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to load secret: %w", err)
+	}
+
+	size := d.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("secret `%s` is corrupted", alias)
+	}
+
+	secret, err := d.aead.Open(nil, data[:size], data[size:], []byte(alias))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt secret `%s`: %w", alias, err)
+	}
+
+	return secret, nil
+}
+
+// DeleteSecret删除密钥
+func (d *SoftwareKeystoreDriver) DeleteSecret(alias string) error {
+	if err := os.Remove(d.path(alias)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to delete secret: %w", err)
+	}
+
+	return nil
+}
+
+// path返回密钥文件的路径，文件名使用alias的哈希，不会泄露密钥名称
+func (d *SoftwareKeystoreDriver) path(alias string) string {
+	sum := sha256.Sum256([]byte(alias))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestKeystoreDriver(t *testing.T, dir string) *SoftwareKeystoreDriver {
+	t.Helper()
+
+	d, err := NewSoftwareKeystoreDriver(dir, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestSoftwareKeystoreDriver(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestKeystoreDriver(t, dir)
+
+	secret, err := d.LoadSecret("missing")
+	if err != nil || secret != nil {
+		t.Fatalf("LoadSecret of a missing alias = %v, %v", secret, err)
+	}
+
+	if err := d.StoreSecret("alias", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StoreSecret("alias", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := d.LoadSecret("alias"); err != nil || string(secret) != "updated" {
+		t.Fatalf("LoadSecret = %q, %v", secret, err)
+	}
+
+	// 使用其他加密密钥无法解密
+	other, err := NewSoftwareKeystoreDriver(dir, bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.LoadSecret("alias"); err == nil {
+		t.Fatal("decrypting with another key should fail")
+	}
+
+	if err := d.DeleteSecret("alias"); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := d.LoadSecret("alias"); err != nil || secret != nil {
+		t.Fatalf("LoadSecret after delete = %v, %v", secret, err)
+	}
+	if err := d.DeleteSecret("alias"); err != nil {
+		t.Fatalf("deleting a missing alias: %v", err)
+	}
+
+	if _, err := NewSoftwareKeystoreDriver(t.TempDir(), []byte("short")); err == nil {
+		t.Fatal("creating a driver with an invalid key should fail")
+	}
+}
@@ -1,5 +1,6 @@
 package core
 
+// NativeMDNSLockerDriver由原生平台实现，用于在mDNS运行期间持有多播锁
 type NativeMDNSLockerDriver interface {
 	Lock()
 	Unlock()
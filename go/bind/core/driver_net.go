@@ -1,26 +1,304 @@
 package core
 
-import "net"
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
 
+	"go.uber.org/zap"
+
+	"github.com/marssuren/gomobile_ipfs_0/go/pkg/ipfsutil"
+)
+
+// NativeNetDriver由原生平台实现，用于在Go无法直接访问系统网络接口时提供接口信息
 type NativeNetDriver interface {
 	InterfaceAddrs() (*NetAddrs, error)
 	Interfaces() (*NetInterfaces, error)
 }
 
+// NetAddrs是原生平台提供的地址列表，地址为CIDR格式(例如"192.168.1.2/24"、"fe80::1/64")
+// 也可以是不带前缀长度的IP地址，此时视为单个主机地址
 type NetAddrs struct {
 	addrs []string
 }
 
+// NewNetAddrs创建空的地址列表
+func NewNetAddrs() *NetAddrs {
+	return &NetAddrs{addrs: []string{}}
+}
+
+// AppendAddr添加一个地址
+func (na *NetAddrs) AppendAddr(addr string) {
+	na.addrs = append(na.addrs, addr)
+}
+
+// NetInterfaces是原生平台提供的网络接口列表
 type NetInterfaces struct {
 	ifaces []*NetInterface
 }
 
+// NewNetInterfaces创建空的网络接口列表
+func NewNetInterfaces() *NetInterfaces {
+	return &NetInterfaces{ifaces: []*NetInterface{}}
+}
+
+// AppendInterface添加一个网络接口
+func (ni *NetInterfaces) AppendInterface(iface *NetInterface) {
+	ni.ifaces = append(ni.ifaces, iface)
+}
+
+// 网络接口标志的名称，与net.Flags.String()的输出一致
+const (
+	NetFlagUp           = "up"
+	NetFlagBroadcast    = "broadcast"
+	NetFlagLoopback     = "loopback"
+	NetFlagPointToPoint = "pointtopoint"
+	NetFlagMulticast    = "multicast"
+	NetFlagRunning      = "running"
+)
+
+var netFlags = map[string]net.Flags{
+	NetFlagUp:           net.FlagUp,
+	NetFlagBroadcast:    net.FlagBroadcast,
+	NetFlagLoopback:     net.FlagLoopback,
+	NetFlagPointToPoint: net.FlagPointToPoint,
+	NetFlagMulticast:    net.FlagMulticast,
+	NetFlagRunning:      net.FlagRunning,
+}
+
 type NetInterface struct {
 	Index int       // positive integer that starts at one, zero is never used
 	MTU   int       // maximum transmission unit
 	Name  string    // e.g., "en0", "lo0", "eth0.100"
 	Addrs *NetAddrs // InterfaceAddresses
 
-	hardwareaddr []byte    // IEEE MAC-48, EUI-48 and EUI-64 form
-	flags        net.Flags // e.g., FlagUp, FlagLoopback, FlagMulticast
+	hardwareaddr string   // IEEE MAC-48, EUI-48 and EUI-64 form, e.g. "00:00:5e:00:53:01"
+	flags        []string // e.g., NetFlagUp, NetFlagLoopback, NetFlagMulticast
+}
+
+// NewNetInterface创建网络接口，地址、硬件地址和标志通过对应的方法设置
+func NewNetInterface(index int, mtu int, name string) *NetInterface {
+	return &NetInterface{
+		Index: index,
+		MTU:   mtu,
+		Name:  name,
+		Addrs: NewNetAddrs(),
+	}
+}
+
+// SetHardwareAddr设置硬件地址，格式与net.ParseMAC相同
+func (ni *NetInterface) SetHardwareAddr(addr string) {
+	ni.hardwareaddr = addr
+}
+
+// AddFlag添加接口标志，见NetFlag*常量
+func (ni *NetInterface) AddFlag(flag string) {
+	ni.flags = append(ni.flags, flag)
+}
+
+var (
+	muNetDrivers sync.Mutex
+	// netDrivers是使用原生网络驱动的节点的驱动，ipfsutil的网络驱动是进程全局的，使用最后创建的节点的驱动
+	netDrivers []*inet
+	// defaultNetDriver是第一个节点设置驱动之前ipfsutil使用的驱动，所有节点关闭后恢复
+	defaultNetDriver ipfsutil.Net
+)
+
+// pushNetDriver把节点的驱动设置为ipfsutil的网络驱动
+func pushNetDriver(d *inet) {
+	muNetDrivers.Lock()
+	defer muNetDrivers.Unlock()
+
+	if len(netDrivers) == 0 {
+		defaultNetDriver = ipfsutil.GetNetDriver()
+	}
+
+	netDrivers = append(netDrivers, d)
+	ipfsutil.SetNetDriver(d)
+}
+
+// removeNetDriver在节点关闭时移除它的驱动，恢复仍在运行的节点中最后创建的节点的驱动或默认驱动
+// d为nil或已经移除时不做任何事
+func removeNetDriver(d *inet) {
+	muNetDrivers.Lock()
+	defer muNetDrivers.Unlock()
+
+	for i, nd := range netDrivers {
+		if nd != d {
+			continue
+		}
+
+		netDrivers = append(netDrivers[:i], netDrivers[i+1:]...)
+		if len(netDrivers) == 0 {
+			ipfsutil.SetNetDriver(defaultNetDriver)
+			defaultNetDriver = nil
+		} else {
+			ipfsutil.SetNetDriver(netDrivers[len(netDrivers)-1])
+		}
+		return
+	}
+}
+
+// inet将原生网络驱动适配为ipfsutil.Net
+type inet struct {
+	net    NativeNetDriver
+	logger *zap.Logger
+}
+
+var _ ipfsutil.Net = (*inet)(nil)
+
+func (ia *inet) InterfaceAddrs() ([]net.Addr, error) {
+	na, err := ia.net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	return ia.parseAddrs(na), nil
+}
+
+func (ia *inet) Interfaces() ([]net.Interface, error) {
+	ni, err := ia.net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	if ni == nil {
+		return []net.Interface{}, nil
+	}
+
+	ifaces := make([]net.Interface, 0, len(ni.ifaces))
+	for _, iface := range ni.ifaces {
+		if iface == nil {
+			continue
+		}
+
+		ifaces = append(ifaces, net.Interface{
+			Index:        iface.Index,
+			MTU:          iface.MTU,
+			Name:         iface.Name,
+			HardwareAddr: ia.parseHardwareAddr(iface),
+			Flags:        ia.parseFlags(iface),
+		})
+	}
+
+	return ifaces, nil
+}
+
+// parseAddrs将CIDR格式的地址字符串转换为net.Addr，无法解析的地址会被忽略
+func (ia *inet) parseAddrs(na *NetAddrs) []net.Addr {
+	if na == nil {
+		return []net.Addr{}
+	}
+
+	addrs := make([]net.Addr, 0, len(na.addrs))
+	for _, addr := range na.addrs {
+		ipnet, err := parseAddr(addr)
+		if err != nil {
+			ia.logger.Warn("unable to parse interface address", zap.String("addr", addr), zap.Error(err))
+			continue
+		}
+
+		addrs = append(addrs, ipnet)
+	}
+
+	return addrs
+}
+
+// parseHardwareAddr解析接口的硬件地址，没有或无法解析时返回nil
+func (ia *inet) parseHardwareAddr(iface *NetInterface) net.HardwareAddr {
+	if iface.hardwareaddr == "" {
+		return nil
+	}
+
+	hw, err := net.ParseMAC(iface.hardwareaddr)
+	if err != nil {
+		ia.logger.Warn("unable to parse hardware address", zap.String("iface", iface.Name), zap.Error(err))
+		return nil
+	}
+
+	return hw
+}
+
+// parseFlags将标志名称转换为net.Flags，未知的标志会被忽略
+func (ia *inet) parseFlags(iface *NetInterface) net.Flags {
+	var flags net.Flags
+	for _, name := range iface.flags {
+		flag, ok := netFlags[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			ia.logger.Warn("unknown interface flag", zap.String("iface", iface.Name), zap.String("flag", name))
+			continue
+		}
+
+		flags |= flag
+	}
+
+	return flags
+}
+
+// parseAddr解析CIDR格式或不带前缀长度的IP地址
+func parseAddr(addr string) (*net.IPNet, error) {
+	if ip, ipnet, err := net.ParseCIDR(addr); err == nil {
+		return &net.IPNet{IP: ip, Mask: ipnet.Mask}, nil
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address `%s`", addr)
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// NotifyNetworkChanged由原生平台在网络发生变化(如Wi-Fi与蜂窝网络切换)时调用
+// 重新解析网络接口，重新绑定swarm监听器，并在新的接口上重新启动mDNS
+// 节点离线或挂起时只记录日志，恢复网络时会使用新的接口
+func (n *Node) NotifyNetworkChanged() error {
+	n.muState.Lock()
+	defer n.muState.Unlock()
+
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("node is closed")
+	}
+
+	ifaces, err := ipfsutil.GetMulticastInterfaces()
+	if err != nil {
+		n.logger.Warn("unable to resolve network interfaces", zap.Error(err))
+	} else {
+		n.logger.Info("network changed", zap.Int("multicast_interfaces", len(ifaces)))
+	}
+
+	if !n.IsOnline() || n.suspended != nil {
+		return nil
+	}
+
+	im := n.mobile()
+	h := im.PeerHost()
+
+	// 旧接口上的监听套接字可能已经失效，在相同的地址上重新监听
+	addrs := closeSwarmListeners(n.logger, h)
+	if len(addrs) > 0 {
+		if err := h.Network().Listen(addrs...); err != nil {
+			return fmt.Errorf("unable to listen on swarm addresses: %w", err)
+		}
+	}
+
+	cfg, err := n.repo.mr.Config()
+	if err != nil {
+		return fmt.Errorf("unable to get repo config: %w", err)
+	}
+
+	n.stopMDNS()
+	if cfg.Discovery.MDNS.Enabled {
+		if err := n.startMDNS(im); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestParseAddr(t *testing.T) {
+	for _, c := range []struct {
+		addr string
+		want string
+	}{
+		{"192.168.1.2/24", "192.168.1.2/24"},
+		{"fe80::1/64", "fe80::1/64"},
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"::1", "::1/128"},
+	} {
+		ipnet, err := parseAddr(c.addr)
+		if err != nil {
+			t.Fatalf("parseAddr(%q): %v", c.addr, err)
+		}
+		if ipnet.String() != c.want {
+			t.Errorf("parseAddr(%q) = %s, want %s", c.addr, ipnet, c.want)
+		}
+	}
+
+	for _, addr := range []string{"", "not-an-ip", "10.0.0.1/33"} {
+		if _, err := parseAddr(addr); err == nil {
+			t.Errorf("parseAddr(%q) should fail", addr)
+		}
+	}
+}
+
+func TestInetInterfaces(t *testing.T) {
+	wlan := NewNetInterface(2, 1500, "wlan0")
+	wlan.Addrs.AppendAddr("192.168.1.2/24")
+	wlan.SetHardwareAddr("00:00:5e:00:53:01")
+	wlan.AddFlag(NetFlagUp)
+	wlan.AddFlag(" Multicast ")
+	wlan.AddFlag("unknown")
+
+	bad := NewNetInterface(3, 1500, "bad0")
+	bad.SetHardwareAddr("not-a-mac")
+
+	ifaces := NewNetInterfaces()
+	ifaces.AppendInterface(wlan)
+	ifaces.AppendInterface(nil)
+	ifaces.AppendInterface(bad)
+
+	addrs := NewNetAddrs()
+	addrs.AppendAddr("192.168.1.2/24")
+	addrs.AppendAddr("invalid")
+
+	ia := &inet{net: &staticNetDriver{addrs: addrs, ifaces: ifaces}, logger: zap.NewNop()}
+
+	got, err := ia.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Interfaces returned %d interfaces", len(got))
+	}
+	if got[0].Index != 2 || got[0].MTU != 1500 || got[0].Name != "wlan0" {
+		t.Fatalf("unexpected interface: %+v", got[0])
+	}
+	if got[0].HardwareAddr.String() != "00:00:5e:00:53:01" {
+		t.Fatalf("HardwareAddr = %s", got[0].HardwareAddr)
+	}
+	if got[0].Flags != net.FlagUp|net.FlagMulticast {
+		t.Fatalf("Flags = %s", got[0].Flags)
+	}
+	if got[1].HardwareAddr != nil || got[1].Flags != 0 {
+		t.Fatalf("unexpected interface: %+v", got[1])
+	}
+
+	// 无法解析的地址被忽略
+	gotAddrs, err := ia.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotAddrs) != 1 || gotAddrs[0].String() != "192.168.1.2/24" {
+		t.Fatalf("InterfaceAddrs = %v", gotAddrs)
+	}
+
+	// 原生驱动返回nil列表
+	ia = &inet{net: &staticNetDriver{}, logger: zap.NewNop()}
+	if got, err := ia.Interfaces(); err != nil || len(got) != 0 {
+		t.Fatalf("Interfaces = %v, %v", got, err)
+	}
+	if got, err := ia.InterfaceAddrs(); err != nil || len(got) != 0 {
+		t.Fatalf("InterfaceAddrs = %v, %v", got, err)
+	}
+
+	// 原生驱动的错误原样返回
+	ia = &inet{net: &testNetDriver{err: errors.New("no network access")}, logger: zap.NewNop()}
+	if _, err := ia.Interfaces(); err == nil {
+		t.Fatal("Interfaces should fail")
+	}
+	if _, err := ia.InterfaceAddrs(); err == nil {
+		t.Fatal("InterfaceAddrs should fail")
+	}
+}
+
+func TestNotifyNetworkChanged(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+
+	if err := a.NotifyNetworkChanged(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新绑定监听器后其他节点仍然可以连接
+	if len(a.mobile().PeerHost().Network().ListenAddresses()) == 0 {
+		t.Fatal("no swarm listeners after network change")
+	}
+	connectTestNodes(t, b, a)
+
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.NotifyNetworkChanged(); err != nil {
+		t.Fatalf("NotifyNetworkChanged while offline: %v", err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.NotifyNetworkChanged(); err == nil {
+		t.Fatal("NotifyNetworkChanged on a closed node should fail")
+	}
+}
+
+// staticNetDriver返回固定的地址和接口列表
+type staticNetDriver struct {
+	addrs  *NetAddrs
+	ifaces *NetInterfaces
+}
+
+func (d *staticNetDriver) InterfaceAddrs() (*NetAddrs, error)  { return d.addrs, nil }
+func (d *staticNetDriver) Interfaces() (*NetInterfaces, error) { return d.ifaces, nil }
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ipfs/boxo/files"
+	ipfs_core "github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	ipfs_corehttp "github.com/ipfs/kubo/core/corehttp"
+)
+
+// maxGatewayUploadSize是通过可写网关上传的内容的最大字节数
+// 更大的文件应使用AddFile或NewRequest("add").Body
+const maxGatewayUploadSize = 32 << 20
+
+// writableGatewayOption允许通过POST /ipfs/向节点添加内容
+// kubo已移除可写网关，这里只保留应用内最常用的上传功能
+// 请求必须带有"Authorization: Bearer <token>"头，请求体不能超过maxGatewayUploadSize
+// 成功时返回201，Location和Ipfs-Hash头中包含新内容的路径和CID
+func writableGatewayOption(token string) ipfs_corehttp.ServeOption {
+	return func(n *ipfs_core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		api, err := coreapi.NewCoreAPI(n)
+		if err != nil {
+			return nil, err
+		}
+
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/ipfs/" {
+				childMux.ServeHTTP(w, r)
+				return
+			}
+
+			if !validGatewayToken(r, token) {
+				http.Error(w, "missing or invalid gateway write token", http.StatusUnauthorized)
+				return
+			}
+
+			body := http.MaxBytesReader(w, r.Body, maxGatewayUploadSize)
+			p, err := api.Unixfs().Add(r.Context(), files.NewReaderFile(body))
+			if err != nil {
+				status := http.StatusInternalServerError
+				if errors.As(err, new(*http.MaxBytesError)) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				http.Error(w, "failed to add content: "+err.Error(), status)
+				return
+			}
+
+			w.Header().Set("Ipfs-Hash", p.RootCid().String())
+			w.Header().Set("Location", p.String())
+			w.WriteHeader(http.StatusCreated)
+		})
+
+		return childMux, nil
+	}
+}
+
+// validGatewayToken判断请求是否带有正确的上传令牌
+func validGatewayToken(r *http.Request, token string) bool {
+	got := r.Header.Get("Authorization")
+	want := "Bearer " + token
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// newGatewayToken生成可写网关的上传令牌
+func newGatewayToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate gateway token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
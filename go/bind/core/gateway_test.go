@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// gatewayURL把网关返回的多地址转换为HTTP地址
+func gatewayURL(t *testing.T, maddr string) string {
+	t.Helper()
+
+	addr, err := ma.NewMultiaddr(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, _ := addr.ValueForProtocol(ma.P_IP4)
+	port, _ := addr.ValueForProtocol(ma.P_TCP)
+
+	return "http://" + ip + ":" + port
+}
+
+func gatewayUpload(t *testing.T, url string, token string, body []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url+"/ipfs/", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func TestServeGateway(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	res, err := n.AddBytes([]byte("hello gateway"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maddr, err := n.ServeGateway("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(maddr, "/ip4/127.0.0.1/tcp/") || strings.HasSuffix(maddr, "/tcp/0") {
+		t.Fatalf("unexpected gateway address %s", maddr)
+	}
+	url := gatewayURL(t, maddr)
+
+	resp, err := http.Get(url + "/ipfs/" + res.Cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello gateway" {
+		t.Fatalf("GET /ipfs/%s: %d %q", res.Cid, resp.StatusCode, body)
+	}
+
+	// 只读网关不接受上传，即使带有令牌
+	if resp := gatewayUpload(t, url, n.GatewayWriteToken(), []byte("upload")); resp.StatusCode == http.StatusCreated {
+		t.Fatal("read-only gateway accepted an upload")
+	}
+
+	if _, err := n.ServeGateway("/ip4/127.0.0.1/tcp/not-a-port", false); err == nil {
+		t.Fatal("invalid multiaddr should fail")
+	}
+}
+
+func TestServeWritableGateway(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	maddr, err := n.ServeGateway("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := gatewayURL(t, maddr)
+
+	if resp := gatewayUpload(t, url, "", []byte("upload")); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload without a token: status %d", resp.StatusCode)
+	}
+	if resp := gatewayUpload(t, url, "wrong", []byte("upload")); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload with a wrong token: status %d", resp.StatusCode)
+	}
+
+	resp := gatewayUpload(t, url, n.GatewayWriteToken(), []byte("upload"))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: status %d", resp.StatusCode)
+	}
+	cid := resp.Header.Get("Ipfs-Hash")
+	data, err := n.Cat(cid, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "upload" {
+		t.Fatalf("uploaded content = %q", data)
+	}
+
+	big := make([]byte, maxGatewayUploadSize+1)
+	if resp := gatewayUpload(t, url, n.GatewayWriteToken(), big); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: status %d", resp.StatusCode)
+	}
+}
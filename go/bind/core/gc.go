@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/kubo/core/corerepo"
+	"github.com/ipfs/kubo/gc"
+	"go.uber.org/zap"
+)
+
+// GCListener由原生平台实现，用于接收垃圾回收的进度
+// 回调在垃圾回收的goroutine上按顺序进行
+type GCListener interface {
+	// HandleGCRemoved在删除一个块后回调
+	HandleGCRemoved(cid string)
+}
+
+// GCResult是一次垃圾回收的结果
+type GCResult struct {
+	Removed    int64 // 删除的块数量
+	FreedBytes int64 // 回收前后仓库大小的差值
+}
+
+// GCTask是正在运行的垃圾回收
+type GCTask struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	result *GCResult
+	err    error
+}
+
+// Cancel停止垃圾回收，已删除的块不会恢复，可以重复调用
+func (t *GCTask) Cancel() {
+	t.cancel()
+}
+
+// Wait等待垃圾回收结束并返回结果，取消时返回已删除的块数量和取消的错误
+func (t *GCTask) Wait() (*GCResult, error) {
+	<-t.done
+	return t.result, t.err
+}
+
+// RunGC在后台删除所有没有被固定、也不在MFS中的块
+// listener可以为nil，通过返回的GCTask取消或等待结束，节点关闭时垃圾回收也会停止
+func (n *Node) RunGC(listener GCListener) (*GCTask, error) {
+	if n.ctx.Err() != nil {
+		return nil, fmt.Errorf("node is closed")
+	}
+
+	ctx, cancel := context.WithCancel(n.ctx)
+	t := &GCTask{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	var onRemoved func(cid string)
+	if listener != nil {
+		onRemoved = listener.HandleGCRemoved
+	}
+
+	go func() {
+		defer close(t.done)
+		defer cancel()
+
+		t.result, t.err = n.runGC(ctx, onRemoved)
+	}()
+
+	return t, nil
+}
+
+// runGC运行垃圾回收，每删除一个块调用一次onRemoved，结束后重新检查存储配额
+func (n *Node) runGC(ctx context.Context, onRemoved func(cid string)) (*GCResult, error) {
+	n.muGC.Lock()
+	defer n.muGC.Unlock()
+
+	// 等待期间可能已被取消(例如看门狗在节点关闭前被停止)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mnode := n.mobile()
+	logger := n.logger.Named("gc")
+
+	before, err := n.repo.mr.GetStorageUsage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get repo size: %w", err)
+	}
+
+	roots, err := corerepo.BestEffortRoots(mnode.FilesRoot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get MFS root: %w", err)
+	}
+
+	res := &GCResult{}
+	var errs []error
+
+	out := gc.GC(ctx, mnode.Blockstore, mnode.Repo.Datastore(), mnode.Pinning, roots)
+	for r := range out {
+		if r.Error != nil {
+			errs = append(errs, r.Error)
+			continue
+		}
+
+		res.Removed++
+		if onRemoved != nil {
+			onRemoved(r.KeyRemoved.String())
+		}
+	}
+
+	// 删除的块不会从缓存的使用量中扣除，重新统计
+	n.storage.quota.invalidate()
+
+	if after, err := n.repo.mr.GetStorageUsage(ctx); err == nil && after < before {
+		res.FreedBytes = int64(before - after)
+	}
+
+	logger.Info("garbage collection finished", zap.Int64("removed", res.Removed), zap.Int64("freed", res.FreedBytes))
+
+	if _, err := n.checkStorageQuota(ctx, 0); err != nil {
+		logger.Warn("unable to check storage quota", zap.Error(err))
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		return res, ctx.Err()
+	case len(errs) == 1:
+		return res, errs[0]
+	case len(errs) > 1:
+		return res, corerepo.NewMultiError(errs...)
+	}
+
+	return res, nil
+}
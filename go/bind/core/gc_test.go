@@ -0,0 +1,95 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+)
+
+type testGCListener struct {
+	removed []string
+}
+
+func (l *testGCListener) HandleGCRemoved(cid string) {
+	l.removed = append(l.removed, cid)
+}
+
+func TestRunGC(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	pinned, err := n.AddBytes(randomBytes(t, 4096), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpinned, err := n.AddBytes(randomBytes(t, 4096), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := &testGCListener{}
+	task, err := n.RunGC(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := task.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed == 0 || int(res.Removed) != len(listener.removed) {
+		t.Fatalf("removed %d blocks, listener got %d", res.Removed, len(listener.removed))
+	}
+
+	want, err := cid.Decode(unpinned.Cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range listener.removed {
+		if c, err := cid.Decode(s); err == nil && c.Hash().String() == want.Hash().String() {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("unpinned block %s was not removed", unpinned.Cid)
+	}
+
+	if _, err := n.Cat(pinned.Cid, 0, 0, 0); err != nil {
+		t.Fatalf("pinned content removed: %v", err)
+	}
+}
+
+func TestRunGCRefreshesQuota(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	setTestStorageMax(t, n, 64<<10)
+	if _, err := n.AddBytes(randomBytes(t, 48<<10), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.AddBytes(randomBytes(t, 48<<10), false); err == nil {
+		t.Fatal("AddBytes over the quota should fail")
+	}
+
+	task, err := n.RunGC(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 垃圾回收后重新统计仓库大小，释放的空间可以再次使用
+	if _, err := n.AddBytes(randomBytes(t, 48<<10), false); err != nil {
+		t.Fatalf("AddBytes after garbage collection: %v", err)
+	}
+}
+
+func TestRunGCClosedNode(t *testing.T) {
+	n := newTestNode(t, nil)
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.RunGC(nil); err == nil {
+		t.Fatal("RunGC on a closed node should fail")
+	}
+}
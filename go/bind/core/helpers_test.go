@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	ipfs_config "github.com/ipfs/kubo/config"
+	p2p_peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTestConfig返回只监听本地回环地址、不连接引导节点、不使用mDNS的配置，测试不会访问外部网络
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cfg.getConfig()
+	c.Addresses.Swarm = []string{"/ip4/127.0.0.1/tcp/0"}
+	c.Bootstrap = []string{}
+	c.Discovery.MDNS.Enabled = false
+	c.Routing.Type = ipfs_config.NewOptionalString("dht")
+	c.AutoTLS.Enabled = ipfs_config.False
+	c.Swarm.DisableNatPortMap = true
+
+	return cfg
+}
+
+// newTestNode在临时目录中创建仓库并启动节点，测试结束时关闭节点
+func newTestNode(t *testing.T, cfg *Config) *Node {
+	t.Helper()
+
+	return newTestNodeWithConfig(t, cfg, nil)
+}
+
+// newTestNodeWithConfig与newTestNode相同，但使用给定的节点配置
+func newTestNodeWithConfig(t *testing.T, cfg *Config, config *NodeConfig) *Node {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = newTestConfig(t)
+	}
+
+	path := t.TempDir()
+	if err := InitRepo(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewNode(r, config)
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+
+	return n
+}
+
+// connectTestNodes连接两个在线节点
+func connectTestNodes(t *testing.T, a, b *Node) {
+	t.Helper()
+
+	ha, hb := a.mobile().PeerHost(), b.mobile().PeerHost()
+	if err := ha.Connect(context.Background(), p2p_peer.AddrInfo{ID: hb.ID(), Addrs: hb.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor轮询cond直到返回true，超时时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// randomBytes返回size个随机字节，添加后得到一个新的块
+func randomBytes(t *testing.T, size int) []byte {
+	t.Helper()
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// portOf返回监听地址的端口
+func portOf(addr net.Addr) string {
+	_, port, _ := net.SplitHostPort(addr.String())
+	return port
+}
+
+func newTestRepoPath(t *testing.T) string {
+	t.Helper()
+
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir()
+	if err := InitRepo(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
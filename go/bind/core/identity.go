@@ -0,0 +1,231 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	ipfs_config "github.com/ipfs/kubo/config"
+	libp2p_ci "github.com/libp2p/go-libp2p/core/crypto"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	identityBlobVersion = 1
+	identityBlobKDF     = "scrypt"
+
+	// scrypt参数，在手机上派生密钥大约需要一百毫秒
+	identityScryptN = 1 << 15
+	identityScryptR = 8
+	identityScryptP = 1
+
+	// identityScryptMaxN限制导入时接受的参数，防止构造的数据耗尽内存
+	identityScryptMaxN = 1 << 20
+
+	// rotatedKeyPrefix是轮换身份后旧私钥在密钥库中的名称前缀，后面是旧的节点ID
+	rotatedKeyPrefix = "identity-"
+)
+
+// identityBlob是导出的身份，私钥用口令派生的密钥通过AES-GCM加密
+type identityBlob struct {
+	Version    int    `json:"version"`
+	PeerID     string `json:"peerID"` // 未加密，用于导入前确认身份，同时作为附加数据防止被替换
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ExportIdentity导出用口令加密的节点身份(节点ID和私钥)，用于在新设备上通过InitRepoWithIdentity保留节点ID
+// 私钥保存在原生密钥库中时，需要先创建节点或调用SetKeystoreDriver
+func (r *Repo) ExportIdentity(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+
+	cfg, err := r.identityRepo().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if isNativeKeyRef(cfg.Identity.PrivKey) {
+		return nil, fmt.Errorf("repo identity is stored in the native keystore, a keystore driver is required")
+	}
+
+	sk, err := cfg.Identity.DecodePrivateKey("")
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode private key: %w", err)
+	}
+
+	skbytes, err := libp2p_ci.MarshalPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := identityBlob{
+		Version: identityBlobVersion,
+		PeerID:  cfg.Identity.PeerID,
+		KDF:     identityBlobKDF,
+		N:       identityScryptN,
+		R:       identityScryptR,
+		P:       identityScryptP,
+		Salt:    make([]byte, 16),
+	}
+
+	if _, err := rand.Read(blob.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := blob.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	blob.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(blob.Nonce); err != nil {
+		return nil, err
+	}
+
+	blob.Ciphertext = aead.Seal(nil, blob.Nonce, skbytes, []byte(blob.PeerID))
+	return json.Marshal(&blob)
+}
+
+// InitRepoWithIdentity与InitRepo相同，但使用ExportIdentity导出的身份代替cfg中的身份
+func InitRepoWithIdentity(path string, cfg *Config, blob []byte, passphrase string) error {
+	if cfg == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	identity, err := decodeIdentityBlob(blob, passphrase)
+	if err != nil {
+		return err
+	}
+
+	clone, err := cfg.getConfig().Clone()
+	if err != nil {
+		return err
+	}
+	clone.Identity = identity
+
+	return InitRepo(path, &Config{clone})
+}
+
+// RotateIdentity生成新的身份代替仓库的身份，返回旧私钥在密钥库中的名称("identity-<旧节点ID>")
+// keyType与NewDefaultConfigWithKey相同，为空时使用Ed25519
+// 正在运行的节点需要重新创建后才会使用新的身份
+func (r *Repo) RotateIdentity(keyType string) (string, error) {
+	identity, err := identityConfig(io.Discard, keyType, 0)
+	if err != nil {
+		return "", err
+	}
+
+	repo := r.identityRepo()
+
+	r.mr.muConfig.Lock()
+	defer r.mr.muConfig.Unlock()
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", err
+	}
+
+	if isNativeKeyRef(cfg.Identity.PrivKey) {
+		return "", fmt.Errorf("repo identity is stored in the native keystore, a keystore driver is required")
+	}
+
+	oldKey, err := cfg.Identity.DecodePrivateKey("")
+	if err != nil {
+		return "", fmt.Errorf("unable to decode private key: %w", err)
+	}
+
+	// 与`ipfs key rotate`一样，先把旧私钥保存到密钥库，再写入新身份
+	name := rotatedKeyPrefix + cfg.Identity.PeerID
+	if err := repo.Keystore().Put(name, oldKey); err != nil {
+		return "", fmt.Errorf("unable to save old key in keystore: %w", err)
+	}
+
+	newCfg, err := cfg.Clone()
+	if err != nil {
+		return "", err
+	}
+	newCfg.Identity = identity
+
+	if err := repo.SetConfig(newCfg); err != nil {
+		return "", fmt.Errorf("unable to save new identity: %w", err)
+	}
+
+	return name, nil
+}
+
+// decodeIdentityBlob解密ExportIdentity导出的身份并确认私钥与节点ID一致
+func decodeIdentityBlob(data []byte, passphrase string) (ipfs_config.Identity, error) {
+	ident := ipfs_config.Identity{}
+
+	var blob identityBlob
+	if err := json.Unmarshal(data, &blob); err != nil {
+		return ident, fmt.Errorf("invalid identity: %w", err)
+	}
+
+	if blob.Version != identityBlobVersion {
+		return ident, fmt.Errorf("unsupported identity version %d", blob.Version)
+	}
+
+	if blob.KDF != identityBlobKDF || blob.N <= 1 || blob.N > identityScryptMaxN || blob.R <= 0 || blob.P <= 0 || blob.R*blob.P >= 1<<30 {
+		return ident, fmt.Errorf("unsupported identity key derivation")
+	}
+
+	aead, err := blob.aead(passphrase)
+	if err != nil {
+		return ident, err
+	}
+
+	if len(blob.Nonce) != aead.NonceSize() {
+		return ident, fmt.Errorf("invalid identity nonce")
+	}
+
+	skbytes, err := aead.Open(nil, blob.Nonce, blob.Ciphertext, []byte(blob.PeerID))
+	if err != nil {
+		return ident, fmt.Errorf("unable to decrypt identity, wrong passphrase?")
+	}
+
+	sk, err := libp2p_ci.UnmarshalPrivateKey(skbytes)
+	if err != nil {
+		return ident, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	id, err := libp2p_peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return ident, err
+	}
+
+	if id.String() != blob.PeerID {
+		return ident, fmt.Errorf("private key does not match peer ID %s", blob.PeerID)
+	}
+
+	ident.PeerID = blob.PeerID
+	ident.PrivKey = base64.StdEncoding.EncodeToString(skbytes)
+	return ident, nil
+}
+
+// aead使用口令派生AES-256密钥
+func (b *identityBlob) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), b.Salt, b.N, b.R, b.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
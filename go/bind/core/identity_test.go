@@ -0,0 +1,132 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// repoPeerID返回仓库配置中的Identity.PeerID
+func repoPeerID(t *testing.T, r *Repo) string {
+	t.Helper()
+
+	v, err := r.GetConfigKey("Identity.PeerID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	if err := json.Unmarshal(v, &id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestExportImportIdentity(t *testing.T) {
+	cfg := newTestConfig(t)
+	peerID := cfg.getConfig().Identity.PeerID
+
+	path := t.TempDir()
+	if err := InitRepo(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.ExportIdentity(""); err == nil {
+		t.Fatal("exporting without a passphrase should fail")
+	}
+
+	blob, err := r.ExportIdentity("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 新设备上使用其他身份的默认配置
+	newPath := t.TempDir()
+	if err := InitRepoWithIdentity(newPath, newTestConfig(t), blob, "wrong"); err == nil {
+		t.Fatal("importing with a wrong passphrase should fail")
+	}
+	if err := InitRepoWithIdentity(t.TempDir(), newTestConfig(t), []byte("{}"), "secret"); err == nil {
+		t.Fatal("importing an invalid blob should fail")
+	}
+	if err := InitRepoWithIdentity(t.TempDir(), nil, blob, "secret"); err == nil {
+		t.Fatal("importing without a config should fail")
+	}
+
+	if err := InitRepoWithIdentity(newPath, newTestConfig(t), blob, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	nr, err := OpenRepo(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewNode(nr, nil)
+	if err != nil {
+		nr.Close()
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if got := n.mobile().PeerHost().ID().String(); got != peerID {
+		t.Fatalf("imported node has peer id %s, want %s", got, peerID)
+	}
+}
+
+func TestRotateIdentity(t *testing.T) {
+	path := t.TempDir()
+	if err := InitRepo(path, newTestConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldID := repoPeerID(t, r)
+
+	if _, err := r.RotateIdentity("dsa"); err == nil {
+		t.Fatal("rotating to an unsupported key type should fail")
+	}
+	if got := repoPeerID(t, r); got != oldID {
+		t.Fatal("failed rotation changed the identity")
+	}
+
+	name, err := r.RotateIdentity(KeyTypeSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "identity-"+oldID {
+		t.Fatalf("old key saved as %q", name)
+	}
+
+	newID := repoPeerID(t, r)
+	if newID == oldID {
+		t.Fatal("peer id not rotated")
+	}
+
+	// 旧私钥保存在密钥库中
+	sk, err := r.mr.Repo.Keystore().Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := libp2p_peer.IDFromPrivateKey(sk); err != nil || id.String() != oldID {
+		t.Fatalf("saved key has peer id %s, want %s", id, oldID)
+	}
+
+	n, err := NewNode(r, nil)
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if got := n.mobile().PeerHost().ID().String(); got != newID {
+		t.Fatalf("node started with peer id %s, want %s", got, newID)
+	}
+}
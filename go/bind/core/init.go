@@ -1,10 +1,13 @@
 package core
 
 import (
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/marssuren/gomobile_ipfs_0/go/pkg/ble-driver"
@@ -26,8 +29,8 @@ const defaultConnMgrLowWater = 100
 // grace period
 const defaultConnMgrGracePeriod = time.Second * 20
 
-func initConfig(out io.Writer, nBitsForKeypair int) (*ipfs_config.Config, error) {
-	identity, err := identityConfig(out, nBitsForKeypair)
+func initConfig(out io.Writer, keyType string, nBitsForKeypair int) (*ipfs_config.Config, error) {
+	identity, err := identityConfig(out, keyType, nBitsForKeypair)
 	if err != nil {
 		return nil, err
 	}
@@ -99,22 +102,74 @@ func addressesConfig() ipfs_config.Addresses {
 			ble.DefaultAddr,
 		},
 
-		// @FIXME: use random port here to avoid collision
-		// API:     ipfs_config.Strings{"/ip4/127.0.0.1/tcp/43453"},
-		// Gateway: ipfs_config.Strings{"/ip4/127.0.0.1/tcp/43454"},
+		// API and Gateway are not listed here: they are served on demand by
+		// Node.ServeAPIMultiaddr and Node.ServeGateway, on a random port by
+		// default to avoid collisions.
 	}
 }
 
+// Key types accepted by NewDefaultConfigWithKey.
+const (
+	KeyTypeEd25519   = "ed25519"
+	KeyTypeECDSA     = "ecdsa"
+	KeyTypeSecp256k1 = "secp256k1"
+	KeyTypeRSA       = "rsa"
+)
+
+// defaultKeyType is used for new repos: Ed25519 keys are fast to generate
+// and produce short peer IDs, which keeps BLE multiaddrs small.
+const defaultKeyType = KeyTypeEd25519
+
+// defaultRSABits is the RSA key size used when none is given.
+const defaultRSABits = 2048
+
 // identityConfig initializes a new identity.
-func identityConfig(out io.Writer, nbits int) (ipfs_config.Identity, error) {
-	// TODO guard higher up
+// bits is only used for RSA (key size, at least 2048) and ECDSA (curve size:
+// 256, 384 or 521); zero selects the default.
+func identityConfig(out io.Writer, keyType string, bits int) (ipfs_config.Identity, error) {
 	ident := ipfs_config.Identity{}
-	if nbits < 2048 {
-		return ident, errors.New("bitsize less than 2048 is considered unsafe")
-	}
 
-	fmt.Fprintf(out, "generating %v-bit RSA keypair...", nbits)
-	sk, pk, err := libp2p_ci.GenerateKeyPair(libp2p_ci.RSA, nbits)
+	var (
+		sk  libp2p_ci.PrivKey
+		pk  libp2p_ci.PubKey
+		err error
+	)
+	switch strings.ToLower(keyType) {
+	case "", KeyTypeEd25519:
+		fmt.Fprintf(out, "generating ED25519 keypair...")
+		sk, pk, err = libp2p_ci.GenerateKeyPair(libp2p_ci.Ed25519, -1)
+	case KeyTypeSecp256k1:
+		fmt.Fprintf(out, "generating SECP256K1 keypair...")
+		sk, pk, err = libp2p_ci.GenerateKeyPair(libp2p_ci.Secp256k1, -1)
+	case KeyTypeECDSA:
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return ident, fmt.Errorf("unsupported ECDSA curve size %d, expected 256, 384 or 521", bits)
+		}
+
+		fmt.Fprintf(out, "generating ECDSA %s keypair...", curve.Params().Name)
+		sk, pk, err = libp2p_ci.GenerateECDSAKeyPairWithCurve(curve, rand.Reader)
+	case KeyTypeRSA:
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+
+		if bits < 2048 {
+			return ident, errors.New("bitsize less than 2048 is considered unsafe")
+		}
+
+		fmt.Fprintf(out, "generating %v-bit RSA keypair...", bits)
+		sk, pk, err = libp2p_ci.GenerateKeyPair(libp2p_ci.RSA, bits)
+	default:
+		return ident, fmt.Errorf("unsupported key type `%s`", keyType)
+	}
 	if err != nil {
 		return ident, err
 	}
@@ -144,31 +199,6 @@ func defaultDatastoreConfig() ipfs_config.Datastore {
 		StorageGCWatermark: 90, // 90%
 		GCPeriod:           "1h",
 		BloomFilterSize:    0,
-		Spec: map[string]interface{}{
-			"type": "mount",
-			"mounts": []interface{}{
-				map[string]interface{}{
-					"mountpoint": "/blocks",
-					"type":       "measure",
-					"prefix":     "flatfs.datastore",
-					"child": map[string]interface{}{
-						"type":      "flatfs",
-						"path":      "blocks",
-						"sync":      true,
-						"shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
-					},
-				},
-				map[string]interface{}{
-					"mountpoint": "/",
-					"type":       "measure",
-					"prefix":     "leveldb.datastore",
-					"child": map[string]interface{}{
-						"type":        "levelds",
-						"path":        "datastore",
-						"compression": "none",
-					},
-				},
-			},
-		},
+		Spec:               flatfsDatastoreSpec(true),
 	}
 }
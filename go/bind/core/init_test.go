@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/base64"
+	"io"
+	"testing"
+
+	libp2p_ci "github.com/libp2p/go-libp2p/core/crypto"
+	libp2p_pb "github.com/libp2p/go-libp2p/core/crypto/pb"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestIdentityConfigKeyTypes(t *testing.T) {
+	for _, c := range []struct {
+		keyType string
+		bits    int
+		want    libp2p_pb.KeyType
+	}{
+		{"", 0, libp2p_ci.Ed25519},
+		{KeyTypeEd25519, 0, libp2p_ci.Ed25519},
+		{"ED25519", 0, libp2p_ci.Ed25519},
+		{KeyTypeSecp256k1, 0, libp2p_ci.Secp256k1},
+		{KeyTypeECDSA, 0, libp2p_ci.ECDSA},
+		{KeyTypeECDSA, 384, libp2p_ci.ECDSA},
+		{KeyTypeRSA, 0, libp2p_ci.RSA},
+	} {
+		ident, err := identityConfig(io.Discard, c.keyType, c.bits)
+		if err != nil {
+			t.Fatalf("identityConfig(%q, %d): %v", c.keyType, c.bits, err)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(ident.PrivKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sk, err := libp2p_ci.UnmarshalPrivateKey(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sk.Type() != c.want {
+			t.Errorf("identityConfig(%q, %d) generated a %s key", c.keyType, c.bits, sk.Type())
+		}
+
+		id, err := libp2p_peer.IDFromPrivateKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.String() != ident.PeerID {
+			t.Errorf("PeerID %s does not match the private key", ident.PeerID)
+		}
+	}
+
+	for _, c := range []struct {
+		keyType string
+		bits    int
+	}{
+		{"dsa", 0},
+		{KeyTypeECDSA, 128},
+		{KeyTypeRSA, 1024},
+	} {
+		if _, err := identityConfig(io.Discard, c.keyType, c.bits); err == nil {
+			t.Errorf("identityConfig(%q, %d) should fail", c.keyType, c.bits)
+		}
+	}
+}
+
+func TestRSARepo(t *testing.T) {
+	cfg, err := NewDefaultConfigWithKey(KeyTypeRSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 使用测试的网络配置，只保留RSA身份
+	test := newTestConfig(t)
+	test.getConfig().Identity = cfg.getConfig().Identity
+
+	n := newTestNode(t, test)
+	if got := n.mobile().PeerHost().ID().String(); got != cfg.getConfig().Identity.PeerID {
+		t.Fatalf("node started with peer id %s, want %s", got, cfg.getConfig().Identity.PeerID)
+	}
+
+	if _, err := NewDefaultConfigWithKey(KeyTypeRSA, 1024); err == nil {
+		t.Fatal("creating a config with a 1024-bit RSA key should fail")
+	}
+}
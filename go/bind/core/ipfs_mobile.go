@@ -0,0 +1,204 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	cmds_http "github.com/ipfs/go-ipfs-cmds/http"
+	ipfs_oldcmds "github.com/ipfs/kubo/commands" // IPFS命令接口
+	ipfs_core "github.com/ipfs/kubo/core"        // IPFS核心实现
+	ipfs_commands "github.com/ipfs/kubo/core/commands"
+	"github.com/ipfs/kubo/core/coreapi"
+	ipfs_corehttp "github.com/ipfs/kubo/core/corehttp"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	ipfs_p2p "github.com/ipfs/kubo/core/node/libp2p"
+	p2p_host "github.com/libp2p/go-libp2p/core/host"
+)
+
+type IpfsConfig struct {
+	HostConfig *HostConfig
+	HostOption ipfs_p2p.HostOption
+
+	RoutingConfig *RoutingConfig
+	RoutingOption ipfs_p2p.RoutingOption
+
+	RepoMobile *RepoMobile
+	ExtraOpts  map[string]bool
+
+	// Offline为true时不启动网络(swarm、DHT、bitswap网络等)，只能访问本地数据
+	Offline bool
+}
+
+// IpfsMobile是移动平台IPFS节点实现
+// 封装了标准IPFS节点并添加移动优化功能
+type IpfsMobile struct {
+	// 嵌入IPFS核心节点
+	*ipfs_core.IpfsNode
+	// 引用移动平台仓库
+	Repo *RepoMobile
+
+	// 命令上下文，用于HTTP API
+	commandCtx ipfs_oldcmds.Context
+
+	// 进程内执行命令的处理器，不经过任何套接字
+	cmdsHandler http.Handler
+}
+
+// NewIpfsMobile根据给定配置创建新的IPFS移动节点
+// 这是Go侧创建IPFS节点的底层入口，移动端应使用NewNode
+func NewIpfsMobile(ctx context.Context, cfg *IpfsConfig) (*IpfsMobile, error) {
+	// 填充默认配置值
+	if err := cfg.fillDefault(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// 构建IPFS节点配置
+	buildcfg := &ipfs_core.BuildCfg{
+		Online:                      !cfg.Offline,                                                 // 是否启动网络
+		Permanent:                   false,                                                        // 非永久节点(适合移动设备)
+		DisableEncryptedConnections: false,                                                        // 使用加密连接
+		Repo:                        cfg.RepoMobile,                                               // 使用移动仓库
+		Host:                        NewHostConfigOption(cfg.HostOption, cfg.HostConfig),          // 配置网络主机
+		Routing:                     NewRoutingConfigOption(cfg.RoutingOption, cfg.RoutingConfig), // 配置路由
+		ExtraOpts:                   cfg.ExtraOpts,                                                // 设置额外选项(如pubsub)
+	}
+
+	// 创建IPFS核心节点
+	inode, err := ipfs_core.NewNode(ctx, buildcfg)
+	if err != nil {
+		// 注释掉了解锁仓库的代码
+		// unlockRepo(repoPath)
+		return nil, fmt.Errorf("failed to init ipfs node: %s", err)
+	}
+
+	// 创建命令上下文
+	// 注释表明这可能不是初始化的最佳方式
+	cctx := ipfs_oldcmds.Context{
+		ConfigRoot: cfg.RepoMobile.Path(),  // 配置根路径
+		ReqLog:     &ipfs_oldcmds.ReqLog{}, // 请求日志
+		ConstructNode: func() (*ipfs_core.IpfsNode, error) { // 节点构造函数
+			return inode, nil
+		},
+	}
+
+	// 返回创建的移动IPFS节点
+	im := &IpfsMobile{
+		commandCtx: cctx,           // 命令上下文
+		IpfsNode:   inode,          // IPFS核心节点
+		Repo:       cfg.RepoMobile, // 仓库引用
+	}
+
+	// 进程内命令处理器与HTTP API共用同一套命令树和命令上下文
+	cmdsCfg := cmds_http.NewServerConfig()
+	cmdsCfg.SetAllowedMethods(http.MethodPost)
+	// 命令写入的块由存储看门狗按照应用发起的写入处理
+	im.cmdsHandler = localWritesHandler(cmds_http.NewHandler(&im.commandCtx, ipfs_commands.Root, cmdsCfg))
+
+	return im, nil
+}
+
+// fillDefault为配置填充默认值
+// 确保配置对象包含所有必需的字段
+func (c *IpfsConfig) fillDefault() error {
+	// 仓库是必需的，不能为空
+	if c.RepoMobile == nil {
+		return fmt.Errorf("repo cannot be nil")
+	}
+
+	// 如果额外选项为空，创建空映射
+	if c.ExtraOpts == nil {
+		c.ExtraOpts = make(map[string]bool)
+	}
+
+	// 默认使用DHT(分布式哈希表)作为路由选项
+	if c.RoutingOption == nil {
+		c.RoutingOption = ipfs_p2p.DHTOption
+	}
+
+	// 如果没有路由配置，创建默认配置
+	if c.RoutingConfig == nil {
+		c.RoutingConfig = &RoutingConfig{}
+	}
+
+	// 默认使用标准主机选项
+	if c.HostOption == nil {
+		c.HostOption = ipfs_p2p.DefaultHostOption
+	}
+
+	// 如果没有主机配置，创建默认配置
+	if c.HostConfig == nil {
+		c.HostConfig = &HostConfig{}
+	}
+
+	return nil
+}
+
+// PeerHost返回节点的P2P网络主机
+// 允许访问底层网络功能，离线节点返回nil
+func (im *IpfsMobile) PeerHost() p2p_host.Host {
+	return im.IpfsNode.PeerHost
+}
+
+// Close先停止周期性的bootstrap再关闭节点
+func (im *IpfsMobile) Close() error {
+	im.stopBootstrap()
+
+	return im.IpfsNode.Close()
+}
+
+// stopBootstrap停止周期性的bootstrap，之后可以通过Bootstrap重新启动
+// kubo关闭节点时不会停止bootstrap，它会在节点关闭后继续访问已关闭的数据存储
+func (im *IpfsMobile) stopBootstrap() {
+	if im.IpfsNode.Bootstrapper != nil {
+		im.IpfsNode.Bootstrapper.Close()
+		im.IpfsNode.Bootstrapper = nil
+	}
+}
+
+// CoreAPI返回基于该节点的kubo CoreAPI
+func (im *IpfsMobile) CoreAPI() (coreiface.CoreAPI, error) {
+	return coreapi.NewCoreAPI(im.IpfsNode)
+}
+
+// Serve在给定监听器上提供完整的kubo HTTP RPC API(/api/v0)
+// 该方法会阻塞直到监听器或节点被关闭
+func (im *IpfsMobile) Serve(l net.Listener) error {
+	opts := []ipfs_corehttp.ServeOption{
+		localWritesOption(),
+		ipfs_corehttp.CheckVersionOption(),
+		ipfs_corehttp.CommandsOption(im.commandCtx),
+		ipfs_corehttp.LogOption(),
+	}
+
+	return ipfs_corehttp.Serve(im.IpfsNode, l, opts...)
+}
+
+// ServeGateway在给定监听器上提供HTTP网关(/ipfs、/ipns)，支持路径和子域名两种解析方式
+// writeToken不为空时允许带有该令牌的请求通过POST /ipfs/上传内容
+// 该方法会阻塞直到监听器或节点被关闭
+func (im *IpfsMobile) ServeGateway(l net.Listener, writeToken string) error {
+	cfg, err := im.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	opts := []ipfs_corehttp.ServeOption{localWritesOption()}
+	if writeToken != "" {
+		opts = append(opts, writableGatewayOption(writeToken))
+	}
+
+	opts = append(opts,
+		ipfs_corehttp.HostnameOption(),
+		ipfs_corehttp.GatewayOption("/ipfs", "/ipns"),
+		ipfs_corehttp.VersionOption(),
+		ipfs_corehttp.CheckVersionOption(),
+	)
+
+	if len(cfg.Gateway.RootRedirect) > 0 {
+		opts = append(opts, ipfs_corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
+	}
+
+	return ipfs_corehttp.Serve(im.IpfsNode, l, opts...)
+}
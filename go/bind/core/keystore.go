@@ -0,0 +1,516 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/boxo/keystore"
+	ipfs_config "github.com/ipfs/kubo/config"
+	ipfs_repo "github.com/ipfs/kubo/repo"
+	libp2p_ci "github.com/libp2p/go-libp2p/core/crypto"
+	"go.uber.org/zap"
+)
+
+// nativeKeyRefPrefix是配置中私钥引用的前缀
+// 使用原生密钥库时，Identity.PrivKey只保存"native-keystore:<命名空间>"，私钥保存在原生密钥库中
+const nativeKeyRefPrefix = "native-keystore:"
+
+// isNativeKeyRef返回私钥是否为原生密钥库的引用
+func isNativeKeyRef(privKey string) bool {
+	return strings.HasPrefix(privKey, nativeKeyRefPrefix)
+}
+
+// nativeKeystore把节点身份和IPNS密钥保存在原生密钥库中，实现了keystore.Keystore
+// 同一个命名空间下的密钥:
+//
+//	<命名空间>/identity: 节点身份的私钥
+//	<命名空间>/keys: IPNS密钥名称列表(JSON)，原生密钥库无法列出密钥
+//	<命名空间>/keys/<名称>: IPNS密钥的私钥
+type nativeKeystore struct {
+	driver NativeKeystoreDriver
+	ns     string
+
+	mu       sync.Mutex
+	identity string // 已加载的节点身份私钥(base64)，未加载时为空
+}
+
+var _ keystore.Keystore = (*nativeKeystore)(nil)
+
+func newNativeKeystore(driver NativeKeystoreDriver, ns string) *nativeKeystore {
+	return &nativeKeystore{driver: driver, ns: ns}
+}
+
+// ref返回配置中保存的私钥引用
+func (ks *nativeKeystore) ref() string {
+	return nativeKeyRefPrefix + ks.ns
+}
+
+func (ks *nativeKeystore) identityAlias() string {
+	return ks.ns + "/identity"
+}
+
+func (ks *nativeKeystore) indexAlias() string {
+	return ks.ns + "/keys"
+}
+
+func (ks *nativeKeystore) keyAlias(name string) string {
+	return ks.ns + "/keys/" + name
+}
+
+// loadIdentity返回节点身份的私钥(base64)，与配置中Identity.PrivKey的格式相同
+func (ks *nativeKeystore) loadIdentity() (string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.identity != "" {
+		return ks.identity, nil
+	}
+
+	secret, err := ks.driver.LoadSecret(ks.identityAlias())
+	if err != nil {
+		return "", fmt.Errorf("unable to load identity from native keystore: %w", err)
+	}
+
+	if len(secret) == 0 {
+		return "", fmt.Errorf("identity `%s` not found in native keystore", ks.identityAlias())
+	}
+
+	ks.identity = base64.StdEncoding.EncodeToString(secret)
+	return ks.identity, nil
+}
+
+// storeIdentity把节点身份的私钥(base64)保存到原生密钥库
+func (ks *nativeKeystore) storeIdentity(privKey string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if privKey == ks.identity {
+		return nil
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(privKey)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	if err := ks.storeSecret(ks.identityAlias(), secret); err != nil {
+		return err
+	}
+
+	ks.identity = privKey
+	return nil
+}
+
+// storeSecret保存密钥并读取回来确认，避免原生密钥库静默失败后丢失私钥
+// 调用方必须持有mu
+func (ks *nativeKeystore) storeSecret(alias string, secret []byte) error {
+	if err := ks.driver.StoreSecret(alias, secret); err != nil {
+		return fmt.Errorf("unable to store `%s` in native keystore: %w", alias, err)
+	}
+
+	stored, err := ks.driver.LoadSecret(alias)
+	if err != nil {
+		return fmt.Errorf("unable to verify `%s` in native keystore: %w", alias, err)
+	}
+
+	if !bytes.Equal(stored, secret) {
+		return fmt.Errorf("native keystore did not persist `%s`", alias)
+	}
+
+	return nil
+}
+
+// names返回IPNS密钥名称列表，调用方必须持有mu
+func (ks *nativeKeystore) names() ([]string, error) {
+	data, err := ks.driver.LoadSecret(ks.indexAlias())
+	if err != nil {
+		return nil, fmt.Errorf("unable to load key list from native keystore: %w", err)
+	}
+
+	names := []string{}
+	if len(data) == 0 {
+		return names, nil
+	}
+
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("invalid key list in native keystore: %w", err)
+	}
+
+	return names, nil
+}
+
+// setNames保存IPNS密钥名称列表，调用方必须持有mu
+func (ks *nativeKeystore) setNames(names []string) error {
+	sort.Strings(names)
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	return ks.storeSecret(ks.indexAlias(), data)
+}
+
+// Has返回是否存在给定名称的密钥
+func (ks *nativeKeystore) Has(name string) (bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	names, err := ks.names()
+	if err != nil {
+		return false, err
+	}
+
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Put保存密钥，已存在同名密钥时返回keystore.ErrKeyExists
+func (ks *nativeKeystore) Put(name string, k libp2p_ci.PrivKey) error {
+	if err := validateKeyName(name); err != nil {
+		return err
+	}
+
+	b, err := libp2p_ci.MarshalPrivateKey(k)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	names, err := ks.names()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if n == name {
+			return keystore.ErrKeyExists
+		}
+	}
+
+	if err := ks.storeSecret(ks.keyAlias(name), b); err != nil {
+		return err
+	}
+
+	return ks.setNames(append(names, name))
+}
+
+// Get返回给定名称的密钥，不存在时返回keystore.ErrNoSuchKey
+func (ks *nativeKeystore) Get(name string) (libp2p_ci.PrivKey, error) {
+	if err := validateKeyName(name); err != nil {
+		return nil, err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	b, err := ks.driver.LoadSecret(ks.keyAlias(name))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load key `%s` from native keystore: %w", name, err)
+	}
+
+	if len(b) == 0 {
+		return nil, keystore.ErrNoSuchKey
+	}
+
+	return libp2p_ci.UnmarshalPrivateKey(b)
+}
+
+// Delete删除给定名称的密钥
+func (ks *nativeKeystore) Delete(name string) error {
+	if err := validateKeyName(name); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	names, err := ks.names()
+	if err != nil {
+		return err
+	}
+
+	kept := []string{}
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+
+	// 先更新列表，删除失败时只会残留无法访问的密钥
+	if len(kept) != len(names) {
+		if err := ks.setNames(kept); err != nil {
+			return err
+		}
+	}
+
+	if err := ks.driver.DeleteSecret(ks.keyAlias(name)); err != nil {
+		return fmt.Errorf("unable to delete key `%s` from native keystore: %w", name, err)
+	}
+
+	return nil
+}
+
+// List返回所有密钥的名称
+func (ks *nativeKeystore) List() ([]string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	return ks.names()
+}
+
+// validateKeyName与kubo的文件密钥库一样拒绝空名称和包含路径分隔符的名称
+func validateKeyName(name string) error {
+	if name == "" {
+		return fmt.Errorf("key name must be at least one character")
+	}
+
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("key names may not contain slashes")
+	}
+
+	return nil
+}
+
+// nativeKeystoreRepo是私钥保存在原生密钥库中的仓库
+// 节点读取配置时得到完整的私钥，写入配置时私钥保存到原生密钥库，仓库中只保存引用
+type nativeKeystoreRepo struct {
+	ipfs_repo.Repo
+	ks *nativeKeystore
+}
+
+func (r *nativeKeystoreRepo) Config() (*ipfs_config.Config, error) {
+	cfg, err := r.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	privKey, err := r.ks.loadIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := cfg.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	clone.Identity.PrivKey = privKey
+	return clone, nil
+}
+
+func (r *nativeKeystoreRepo) SetConfig(cfg *ipfs_config.Config) error {
+	clone, err := cfg.Clone()
+	if err != nil {
+		return err
+	}
+
+	previous, err := r.ks.loadIdentity()
+	if err != nil {
+		return err
+	}
+
+	if privKey := clone.Identity.PrivKey; privKey != "" && !isNativeKeyRef(privKey) {
+		if err := r.ks.storeIdentity(privKey); err != nil {
+			return err
+		}
+	}
+
+	clone.Identity.PrivKey = r.ks.ref()
+	if err := r.Repo.SetConfig(clone); err != nil {
+		// 恢复之前的私钥，保证与仓库中的节点ID一致
+		if rerr := r.ks.storeIdentity(previous); rerr != nil {
+			return fmt.Errorf("%w, unable to restore previous identity: %s", err, rerr.Error())
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *nativeKeystoreRepo) Keystore() keystore.Keystore {
+	return r.ks
+}
+
+// SetKeystoreDriver设置原生密钥库驱动，与NodeConfig.SetKeystoreDriver相同
+// 用于在创建节点之前导出或轮换保存在原生密钥库中的身份，仓库中的明文私钥会立即迁移到原生密钥库
+func (r *Repo) SetKeystoreDriver(driver NativeKeystoreDriver) error {
+	if driver == nil {
+		return fmt.Errorf("keystore driver cannot be nil")
+	}
+
+	return r.openKeystore(newLogger(), driver)
+}
+
+// openKeystore打开仓库使用的原生密钥库，driver为nil时沿用之前设置的驱动
+func (r *Repo) openKeystore(logger *zap.Logger, driver NativeKeystoreDriver) error {
+	r.muKeystore.Lock()
+	defer r.muKeystore.Unlock()
+
+	if driver == nil && r.keystore != nil {
+		return nil
+	}
+
+	ks, err := openNativeKeystore(logger, r.mr, driver)
+	if err != nil {
+		return err
+	}
+
+	r.keystore = ks
+	return nil
+}
+
+// identityRepo返回可以读写完整身份的仓库，使用原生密钥库时私钥从原生密钥库读取
+func (r *Repo) identityRepo() ipfs_repo.Repo {
+	r.muKeystore.Lock()
+	defer r.muKeystore.Unlock()
+
+	if r.keystore == nil {
+		return r.mr.Repo
+	}
+
+	return &nativeKeystoreRepo{Repo: r.mr.Repo, ks: r.keystore}
+}
+
+// openNativeKeystore返回仓库使用的原生密钥库，未设置驱动时返回nil
+// 仓库中的私钥仍是明文时，先将私钥和IPNS密钥迁移到原生密钥库
+func openNativeKeystore(logger *zap.Logger, mr *RepoMobile, driver NativeKeystoreDriver) (*nativeKeystore, error) {
+	cfg, err := mr.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	privKey := cfg.Identity.PrivKey
+	if driver == nil {
+		if isNativeKeyRef(privKey) {
+			return nil, fmt.Errorf("repo identity is stored in the native keystore, a keystore driver is required")
+		}
+		return nil, nil
+	}
+
+	if isNativeKeyRef(privKey) {
+		ks := newNativeKeystore(driver, strings.TrimPrefix(privKey, nativeKeyRefPrefix))
+		if _, err := ks.loadIdentity(); err != nil {
+			return nil, err
+		}
+		return ks, nil
+	}
+
+	ks := newNativeKeystore(driver, "ipfs/"+cfg.Identity.PeerID)
+	if err := migrateToNativeKeystore(logger, mr, ks); err != nil {
+		return nil, fmt.Errorf("unable to migrate identity to native keystore: %w", err)
+	}
+
+	return ks, nil
+}
+
+// migrateToNativeKeystore把明文保存的私钥和IPNS密钥迁移到原生密钥库
+// 所有密钥保存成功后才写入引用并删除明文，中途失败时仓库保持原样，可以重新迁移
+func migrateToNativeKeystore(logger *zap.Logger, mr *RepoMobile, ks *nativeKeystore) error {
+	var (
+		privKey string
+		fsks    = mr.Repo.Keystore()
+		names   = []string{}
+	)
+
+	err := mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		privKey = cfg.Identity.PrivKey
+		if privKey == "" {
+			return fmt.Errorf("repo has no private key")
+		}
+
+		if err := ks.storeIdentity(privKey); err != nil {
+			return err
+		}
+
+		if fsks != nil {
+			var err error
+			if names, err = fsks.List(); err != nil {
+				return fmt.Errorf("unable to list keystore: %w", err)
+			}
+
+			for _, name := range names {
+				sk, err := fsks.Get(name)
+				if err != nil {
+					return fmt.Errorf("unable to read key `%s`: %w", name, err)
+				}
+
+				if err := ks.Put(name, sk); err != nil && err != keystore.ErrKeyExists {
+					return err
+				}
+			}
+		}
+
+		cfg.Identity.PrivKey = ks.ref()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 引用已经写入仓库，明文的密钥不再需要
+	for _, name := range names {
+		if err := fsks.Delete(name); err != nil {
+			logger.Warn("unable to delete plaintext key", zap.String("name", name), zap.Error(err))
+		}
+	}
+
+	if err := scrubConfigBackups(mr.Path(), privKey, ks.ref()); err != nil {
+		logger.Warn("unable to scrub config backups", zap.Error(err))
+	}
+
+	return nil
+}
+
+// scrubConfigBackups把应用profile时备份的配置中的明文私钥替换为引用
+func scrubConfigBackups(repoPath string, privKey string, ref string) error {
+	if repoPath == "" {
+		return nil
+	}
+
+	backups, err := filepath.Glob(filepath.Join(repoPath, "config-pre-*"))
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups {
+		b, err := os.ReadFile(backup)
+		if err != nil {
+			return err
+		}
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("invalid config backup `%s`: %w", backup, err)
+		}
+
+		identity, ok := m[ipfs_config.IdentityTag].(map[string]interface{})
+		if !ok || identity[ipfs_config.PrivKeyTag] != privKey {
+			continue
+		}
+		identity[ipfs_config.PrivKeyTag] = ref
+
+		if b, err = ipfs_config.Marshal(m); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(backup, b, 0o600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
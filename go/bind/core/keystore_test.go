@@ -0,0 +1,156 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/boxo/keystore"
+	ipfs_config "github.com/ipfs/kubo/config"
+	libp2p_ci "github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// readRepoPrivKey直接读取仓库配置文件中保存的Identity.PrivKey
+func readRepoPrivKey(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join(path, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg ipfs_config.Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Identity.PrivKey
+}
+
+func TestNativeKeystoreMigration(t *testing.T) {
+	path := t.TempDir()
+	cfg := newTestConfig(t)
+	peerID := cfg.getConfig().Identity.PeerID
+	if err := InitRepo(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 迁移前已有的IPNS密钥
+	sk, _, err := libp2p_ci.GenerateKeyPair(libp2p_ci.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.mr.Repo.Keystore().Put("ipns-key", sk); err != nil {
+		t.Fatal(err)
+	}
+
+	driver := newTestKeystoreDriver(t, t.TempDir())
+	config := NewNodeConfig()
+	config.SetKeystoreDriver(driver)
+
+	n, err := NewNode(r, config)
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	if got := n.mobile().PeerHost().ID().String(); got != peerID {
+		t.Fatalf("node started with peer id %s, want %s", got, peerID)
+	}
+
+	// 仓库中只保存引用，IPNS密钥迁移到原生密钥库
+	if privKey := readRepoPrivKey(t, path); !isNativeKeyRef(privKey) {
+		t.Fatalf("repo still holds a plaintext private key")
+	}
+	names, err := r.keystore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "ipns-key" {
+		t.Fatalf("native keystore keys = %v", names)
+	}
+	if names, err := r.mr.Repo.Keystore().List(); err != nil || len(names) != 0 {
+		t.Fatalf("plaintext keys left after migration: %v, %v", names, err)
+	}
+	got, err := r.keystore.Get("ipns-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(sk) {
+		t.Fatal("migrated key does not match")
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有驱动时无法打开迁移后的仓库
+	r, err = OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewNode(r, nil); err == nil {
+		r.Close()
+		t.Fatal("starting a node without the keystore driver should fail")
+	}
+
+	// 使用其他加密密钥的驱动无法读取身份
+	config = NewNodeConfig()
+	config.SetKeystoreDriver(newTestKeystoreDriver(t, t.TempDir()))
+	if _, err := NewNode(r, config); err == nil {
+		r.Close()
+		t.Fatal("starting a node with an empty keystore should fail")
+	}
+
+	config = NewNodeConfig()
+	config.SetKeystoreDriver(driver)
+	n, err = NewNode(r, config)
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if got := n.mobile().PeerHost().ID().String(); got != peerID {
+		t.Fatalf("node restarted with peer id %s, want %s", got, peerID)
+	}
+}
+
+func TestNativeKeystoreKeys(t *testing.T) {
+	ks := newNativeKeystore(newTestKeystoreDriver(t, t.TempDir()), "test")
+
+	sk, _, err := libp2p_ci.GenerateKeyPair(libp2p_ci.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.Put("key", sk); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("key", sk); err != keystore.ErrKeyExists {
+		t.Fatalf("Put of an existing key = %v", err)
+	}
+	if has, err := ks.Has("key"); err != nil || !has {
+		t.Fatalf("Has = %v, %v", has, err)
+	}
+
+	if err := ks.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("key"); err != keystore.ErrNoSuchKey {
+		t.Fatalf("Get of a deleted key = %v", err)
+	}
+	if names, err := ks.List(); err != nil || len(names) != 0 {
+		t.Fatalf("List = %v, %v", names, err)
+	}
+
+	for _, name := range []string{"", "a/b"} {
+		if err := ks.Put(name, sk); err == nil {
+			t.Errorf("Put(%q) should fail", name)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package core
+
+// StringList是字符串列表，gomobile无法绑定切片，因此通过下标访问
+type StringList struct {
+	items []string
+}
+
+func newStringList(items []string) *StringList {
+	if items == nil {
+		items = []string{}
+	}
+
+	return &StringList{items: items}
+}
+
+// Count返回列表长度
+func (l *StringList) Count() int {
+	return len(l.items)
+}
+
+// Get返回第i项，越界时返回空字符串
+func (l *StringList) Get(i int) string {
+	if i < 0 || i >= len(l.items) {
+		return ""
+	}
+
+	return l.items[i]
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	golog "github.com/ipfs/go-log/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NativeLogger由原生平台实现，用于将日志输出到Logcat或os_log
+// level为"debug"、"info"、"warn"、"error"等，subsystem为日志来源(如"mdns"、"dht")
+// fields为JSON对象格式的结构化字段
+type NativeLogger interface {
+	Log(level string, subsystem string, message string, fields string)
+}
+
+var (
+	muLogger        sync.RWMutex
+	nativeLogger    NativeLogger                 // 为nil时输出到标准错误
+	logLevels       = map[string]zapcore.Level{} // 绑定层各子系统的日志级别
+	defaultLogLevel = zapcore.InfoLevel          // 没有单独设置级别的子系统使用的级别
+	installGoLog    sync.Once                    // go-log只需要接管一次
+
+	// consoleCore是没有设置原生日志时使用的输出，与zap.NewDevelopment的格式一致
+	consoleCore = zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		zapcore.DebugLevel,
+	)
+)
+
+// SetLogger设置原生日志输出，绑定层(包括邻近传输、mDNS和BLE驱动)和kubo(go-log)的日志都会转发给它
+// logger为nil时恢复输出到标准错误
+func SetLogger(logger NativeLogger) {
+	muLogger.Lock()
+	nativeLogger = logger
+	muLogger.Unlock()
+
+	// go-log的子系统级别由go-log自己控制，这里不再过滤
+	installGoLog.Do(func() {
+		golog.SetPrimaryCore(&logCore{})
+	})
+}
+
+// SetLogLevel设置子系统的日志级别，level为"debug"、"info"、"warn"、"error"等
+// subsystem既可以是绑定层的子系统(如"mdns"、"pubsub"、"ProximityTransport")，也可以是go-log的子系统(如"dht"、"bitswap")
+// subsystem为"*"时设置所有子系统
+func SetLogLevel(subsystem string, level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level `%s`: %w", level, err)
+	}
+
+	muLogger.Lock()
+	if subsystem == "*" {
+		defaultLogLevel = lvl
+		logLevels = map[string]zapcore.Level{}
+	} else {
+		logLevels[subsystem] = lvl
+	}
+	muLogger.Unlock()
+
+	// 绑定层的子系统在go-log中不存在
+	if err := golog.SetLogLevel(subsystem, level); err != nil && !errors.Is(err, golog.ErrNoSuchLogger) {
+		return err
+	}
+
+	return nil
+}
+
+// newLogger创建绑定层使用的logger，输出由SetLogger和SetLogLevel控制
+func newLogger() *zap.Logger {
+	return zap.New(&logCore{filter: true}, zap.AddCaller())
+}
+
+// logLevelFor返回子系统的日志级别，依次查找"a.b.c"、"a.b"、"a"
+// 调用方必须持有muLogger
+func logLevelFor(subsystem string) zapcore.Level {
+	for name := subsystem; name != ""; {
+		if lvl, ok := logLevels[name]; ok {
+			return lvl
+		}
+
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	return defaultLogLevel
+}
+
+// logCore将日志条目转发到原生日志或标准错误
+type logCore struct {
+	fields []zapcore.Field
+	filter bool // 是否按SetLogLevel设置的级别过滤
+}
+
+var _ zapcore.Core = (*logCore)(nil)
+
+func (c *logCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *logCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logCore{
+		fields: append(c.fields[:len(c.fields):len(c.fields)], fields...),
+		filter: c.filter,
+	}
+}
+
+func (c *logCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.filter {
+		muLogger.RLock()
+		lvl := logLevelFor(ent.LoggerName)
+		muLogger.RUnlock()
+
+		if ent.Level < lvl {
+			return ce
+		}
+	}
+
+	return ce.AddCore(ent, c)
+}
+
+func (c *logCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := append(c.fields[:len(c.fields):len(c.fields)], fields...)
+
+	muLogger.RLock()
+	logger := nativeLogger
+	muLogger.RUnlock()
+
+	if logger == nil {
+		return consoleCore.Write(ent, all)
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range all {
+		f.AddTo(enc)
+	}
+
+	b, err := json.Marshal(enc.Fields)
+	if err != nil {
+		b = []byte("{}")
+	}
+
+	logger.Log(ent.Level.String(), ent.LoggerName, ent.Message, string(b))
+	return nil
+}
+
+func (c *logCore) Sync() error {
+	return consoleCore.Sync()
+}
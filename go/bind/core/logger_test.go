@@ -0,0 +1,148 @@
+package core
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	golog "github.com/ipfs/go-log/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type testLogEntry struct {
+	level, subsystem, message string
+	fields                    map[string]interface{}
+}
+
+type testNativeLogger struct {
+	mu      sync.Mutex
+	entries []testLogEntry
+}
+
+func (l *testNativeLogger) Log(level string, subsystem string, message string, fields string) {
+	e := testLogEntry{level: level, subsystem: subsystem, message: message}
+	if err := json.Unmarshal([]byte(fields), &e.fields); err != nil {
+		panic(err)
+	}
+
+	l.mu.Lock()
+	l.entries = append(l.entries, e)
+	l.mu.Unlock()
+}
+
+// find返回子系统的第一条日志
+func (l *testNativeLogger) find(subsystem string, message string) *testLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, e := range l.entries {
+		if e.subsystem == subsystem && e.message == message {
+			return &l.entries[i]
+		}
+	}
+	return nil
+}
+
+// setTestLogger设置原生日志输出，测试结束后恢复默认的输出和级别
+func setTestLogger(t *testing.T) *testNativeLogger {
+	t.Helper()
+
+	logger := &testNativeLogger{}
+	SetLogger(logger)
+	t.Cleanup(func() {
+		SetLogger(nil)
+
+		muLogger.Lock()
+		logLevels = map[string]zapcore.Level{}
+		defaultLogLevel = zapcore.InfoLevel
+		muLogger.Unlock()
+	})
+
+	return logger
+}
+
+func TestNativeLogger(t *testing.T) {
+	native := setTestLogger(t)
+
+	logger := newLogger().Named("testlog").With(zap.String("key", "value"))
+	logger.Info("hello", zap.Int("count", 2))
+
+	e := native.find("testlog", "hello")
+	if e == nil {
+		t.Fatal("entry not forwarded")
+	}
+	if e.level != "info" || e.fields["key"] != "value" || e.fields["count"] != float64(2) {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+
+	// 低于默认级别的日志被过滤
+	logger.Debug("filtered")
+	if native.find("testlog", "filtered") != nil {
+		t.Fatal("debug entry not filtered")
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	native := setTestLogger(t)
+
+	if err := SetLogLevel("testlog", "error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLogLevel("testlog.verbose", "debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := newLogger().Named("testlog")
+	logger.Warn("warn")
+	logger.Error("error")
+	logger.Named("sub").Warn("sub warn")
+	logger.Named("verbose").Debug("verbose debug")
+
+	if native.find("testlog", "warn") != nil {
+		t.Fatal("warn entry not filtered")
+	}
+	if native.find("testlog", "error") == nil {
+		t.Fatal("error entry not forwarded")
+	}
+	// 子系统继承上一级的级别
+	if native.find("testlog.sub", "sub warn") != nil {
+		t.Fatal("sub warn entry not filtered")
+	}
+	if native.find("testlog.verbose", "verbose debug") == nil {
+		t.Fatal("verbose debug entry not forwarded")
+	}
+
+	if err := SetLogLevel("*", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("debug")
+	if native.find("testlog", "debug") == nil {
+		t.Fatal("debug entry not forwarded after setting all levels")
+	}
+	if err := SetLogLevel("*", "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetLogLevel("testlog", "verbose"); err == nil {
+		t.Fatal("setting an invalid level should fail")
+	}
+}
+
+func TestGoLogForwarded(t *testing.T) {
+	native := setTestLogger(t)
+
+	logger := golog.Logger("testgolog")
+	if err := SetLogLevel("testgolog", "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Infow("from go-log", "key", "value")
+	e := native.find("testgolog", "from go-log")
+	if e == nil {
+		t.Fatal("go-log entry not forwarded")
+	}
+	if e.level != "info" || e.fields["key"] != "value" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+}
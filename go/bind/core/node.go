@@ -2,133 +2,619 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"sync"
+	"time"
 
-	ipfs_oldcmds "github.com/ipfs/kubo/commands" // IPFS命令接口
-	ipfs_core "github.com/ipfs/kubo/core"        // IPFS核心实现
-	ipfs_p2p "github.com/ipfs/kubo/core/node/libp2p"
-	p2p_host "github.com/libp2p/go-libp2p/core/host"
+	ipfs_config "github.com/ipfs/kubo/config"
+	ipfs_repo "github.com/ipfs/kubo/repo"
+	p2p "github.com/libp2p/go-libp2p"
 	p2p_mdns "github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net" // 多地址网络接口
-)
+	"go.uber.org/zap"
 
-type IpfsConfig struct {
-	HostConfig *HostConfig
-	HostOption ipfs_p2p.HostOption
+	ble "github.com/marssuren/gomobile_ipfs_0/go/pkg/ble-driver"
+	"github.com/marssuren/gomobile_ipfs_0/go/pkg/ipfsutil"
+	proximity "github.com/marssuren/gomobile_ipfs_0/go/pkg/proximitytransport"
+)
 
-	RoutingConfig *RoutingConfig
-	RoutingOption ipfs_p2p.RoutingOption
+// defaultGatewayAddr是网关默认的监听地址，端口由系统随机分配以避免冲突
+const defaultGatewayAddr = "/ip4/127.0.0.1/tcp/0"
 
-	RepoMobile *RepoMobile
-	ExtraOpts  map[string]bool
-}
+// errNodeOffline是在离线节点上执行需要网络的操作时返回的错误
+var errNodeOffline = fmt.Errorf("node is offline")
 
+// Node是暴露给移动平台(gomobile)的IPFS节点
+// 它持有底层的IpfsMobile以及由绑定层自己管理的服务(mDNS、API监听器等)
+// kubo在创建节点时决定是否启动网络，切换在线/离线状态时会重建IpfsMobile，
+// 由绑定层管理的服务、流处理器、节点事件监听器和PubSub订阅会重新挂载到新的节点上
 type Node struct {
 	listeners   []manet.Listener // 网络监听器列表
-	muListeners sync.Mutex       // 保护listeners的互斥锁
+	servers     []*server        // 通过ServeAPIMultiaddr和ServeGateway启动的服务，切换状态后重新启动
+	muListeners sync.Mutex       // 保护listeners和servers的互斥锁
 	mdnsLocker  sync.Locker      // mDNS锁，控制mDNS服务的访问
 	mdnsLocked  bool             // 标记mDNS是否被锁定
 	mdnsService p2p_mdns.Service // mDNS服务，用于本地网络发现
+	netDriver   *inet            // NodeConfig设置的原生网络驱动，Close时从ipfsutil中移除
+
+	muPeerEvents      sync.Mutex        // 保护节点事件监听器和订阅的互斥锁
+	peerEventListener PeerEventListener // 节点事件监听器，由SetPeerEventListener设置
+	peerEventStop     chan bool         // 停止当前的节点事件转发，节点上线时创建
+
+	muStreamHandlers sync.Mutex               // 保护streamHandlers的互斥锁
+	streamHandlers   map[string]StreamHandler // 已注册的流处理器，节点上线时注册到主机
+
+	muPubSub      sync.Mutex                 // 保护PubSub订阅的互斥锁
+	subscriptions map[*Subscription]struct{} // 未取消的PubSub订阅，节点上线时在新的节点上恢复
+	pubsubMobile  *IpfsMobile                // 订阅所在的节点，离线或切换状态期间为nil
+
+	muGC sync.Mutex // 同一时间只运行一次垃圾回收，避免重复遍历块存储
+
+	muQuota       sync.Mutex           // 保护存储配额监听器和状态的互斥锁
+	quotaListener StorageQuotaListener // 存储配额监听器，由SetStorageQuotaListener设置
+	quotaState    string               // 上次通知的配额状态
+
+	muWatchdog sync.Mutex       // 保护watchdog的互斥锁
+	watchdog   *storageWatchdog // 运行中的存储看门狗，由StartStorageWatchdog启动
+	storage    storageGuard     // 存储看门狗和存储配额对写入的限制
+
+	muState    sync.Mutex   // 保证启动、停止和关闭依次进行
+	muMobile   sync.RWMutex // 保护ipfsMobile和online
+	ipfsMobile *IpfsMobile  // 移动平台IPFS节点实例
+	online     bool         // 节点是否启动了网络
+
+	repo     *Repo        // 节点使用的仓库，在节点关闭时关闭
+	hostOpts []p2p.Option // 创建主机时使用的额外选项(如BLE传输)
+
+	allowRemoteAPI bool   // 是否允许API在非本地地址上监听，见NodeConfig.SetAllowRemoteAPI
+	gatewayToken   string // 可写网关的上传令牌
+
+	suspended      *suspendState  // 挂起前的状态，未挂起时为nil，由muState保护
+	suspendSwitch  *suspendSwitch // 当前IpfsMobile的连接管理器和路由的挂起开关，由muState保护
+	suspendTimeout time.Duration  // Suspend和Resume的时限
+
+	ctx    context.Context    // 节点生命周期上下文，Close时取消
+	cancel context.CancelFunc // 取消节点上下文
+	logger *zap.Logger
+}
+
+// server描述一个由节点提供的HTTP服务
+type server struct {
+	maddr string                                     // 实际绑定的多地址
+	serve func(im *IpfsMobile, l net.Listener) error // 在监听器上提供服务，阻塞直到服务结束
+	name  string                                     // 用于日志
+}
+
+// NewNode使用给定的仓库和节点配置创建并启动IPFS节点
+// 这是移动平台(Java/Swift)创建节点的入口，参数和返回值均可被gomobile绑定
+func NewNode(r *Repo, config *NodeConfig) (*Node, error) {
+	if r == nil {
+		return nil, fmt.Errorf("repo cannot be nil")
+	}
+
+	if config == nil {
+		config = NewNodeConfig()
+	}
+
+	logger := newLogger()
+
+	// 加载插件，确保启动节点前插件系统已就绪
+	if _, err := loadPlugins(r.mr.Path()); err != nil {
+		return nil, err
+	}
+
+	if err := r.openKeystore(logger, config.keystoreDriver); err != nil {
+		return nil, err
+	}
+
+	gatewayToken, err := newGatewayToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	hostOpts := []p2p.Option{}
+	switch {
+	// 原生平台提供的BLE驱动(Android)
+	case config.bleDriver != nil:
+		hostOpts = append(hostOpts, p2p.Transport(proximity.NewTransport(ctx, logger, config.bleDriver)))
+	// Go内置的BLE驱动(iOS)
+	case ble.Supported:
+		hostOpts = append(hostOpts, p2p.Transport(proximity.NewTransport(ctx, logger, ble.NewDriver(logger))))
+	default:
+		logger.Info("cannot enable BLE on an unsupported platform")
+	}
+
+	suspendTimeout := config.suspendTimeout
+	if suspendTimeout <= 0 {
+		suspendTimeout = defaultSuspendTimeout
+	}
+
+	n := &Node{
+		suspendTimeout: suspendTimeout,
+		allowRemoteAPI: config.allowRemoteAPI,
+		gatewayToken:   gatewayToken,
+		listeners:      []manet.Listener{},
+		mdnsLocker:     config.mdnsLockerDriver,
+		streamHandlers: map[string]StreamHandler{},
+		subscriptions:  map[*Subscription]struct{}{},
+		repo:           r,
+		hostOpts:       hostOpts,
+		ctx:            ctx,
+		cancel:         cancel,
+		logger:         logger,
+	}
+	n.storage.quota.mr = r.mr
+
+	// 使用原生网络驱动获取网络接口(如Android上无法直接访问netlink)
+	if config.netDriver != nil {
+		n.netDriver = &inet{
+			net:    config.netDriver,
+			logger: logger,
+		}
+		pushNetDriver(n.netDriver)
+	}
+
+	if err := n.start(true); err != nil {
+		removeNetDriver(n.netDriver)
+		cancel()
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// mobile返回当前的IpfsMobile，切换在线状态后会返回新的实例
+func (n *Node) mobile() *IpfsMobile {
+	n.muMobile.RLock()
+	defer n.muMobile.RUnlock()
 
-	ipfsMobile *IpfsMobile // 移动平台IPFS节点实例
+	return n.ipfsMobile
 }
 
-// IpfsMobile是移动平台IPFS节点实现
-// 封装了标准IPFS节点并添加移动优化功能
-type IpfsMobile struct {
-	// 嵌入IPFS核心节点
-	*ipfs_core.IpfsNode
-	// 引用移动平台仓库
-	Repo *RepoMobile
+// IsOnline返回节点是否启动了网络
+func (n *Node) IsOnline() bool {
+	n.muMobile.RLock()
+	defer n.muMobile.RUnlock()
 
-	// 命令上下文，用于HTTP API
-	commandCtx ipfs_oldcmds.Context
+	return n.online
 }
 
-// NewNode根据给定配置创建新的IPFS移动节点
-// 这是创建IPFS节点的主要入口点
-func NewNode(ctx context.Context, cfg *IpfsConfig) (*IpfsMobile, error) {
-	// 填充默认配置值
-	if err := cfg.fillDefault(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// GoOffline停止网络(swarm监听、DHT、bitswap网络、reprovider和mDNS)，节点已离线时不做任何事
+// 仓库、块存储和固定的内容仍然可用，API和网关会在原来的地址上继续提供服务
+// 切换时会重建底层节点：打开的流和正在进行的读取会返回错误，节点事件监听器会收到所有连接的断开事件，
+// PubSub订阅保持有效但离线期间收不到消息
+// 无法在原来的地址上重新启动API或网关时返回错误，节点已经离线
+func (n *Node) GoOffline() error {
+	return n.setOnline(false)
+}
+
+// GoOnline重新启动网络，节点已在线时不做任何事
+// 已注册的流处理器、节点事件监听器和PubSub订阅会在新的节点上重新生效
+// 无法在原来的地址上重新启动API或网关时返回错误，节点已经上线
+func (n *Node) GoOnline() error {
+	return n.setOnline(true)
+}
+
+func (n *Node) setOnline(online bool) error {
+	n.muState.Lock()
+	defer n.muState.Unlock()
+
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("node is closed")
+	}
+
+	if n.IsOnline() == online {
+		return nil
+	}
+
+	// 看门狗的垃圾回收不能在重建节点期间运行，切换后使用相同的配置重新启动
+	w := n.pauseStorageWatchdog()
+	defer n.resumeStorageWatchdog(w)
+
+	if err := n.stop(); err != nil {
+		n.logger.Warn("unable to stop node cleanly", zap.Error(err))
+	}
+
+	err := n.start(online)
+	if err == nil {
+		return n.restartServers(n.mobile())
+	}
+
+	// 无法切换时尝试恢复之前的状态，保证节点仍然可用
+	if rerr := n.start(!online); rerr != nil {
+		return fmt.Errorf("unable to switch node state: %w, unable to restore previous state: %s", err, rerr.Error())
 	}
 
-	// 构建IPFS节点配置
-	buildcfg := &ipfs_core.BuildCfg{
-		Online:                      true,                                                         // 节点处于在线模式
-		Permanent:                   false,                                                        // 非永久节点(适合移动设备)
-		DisableEncryptedConnections: false,                                                        // 使用加密连接
-		Repo:                        cfg.RepoMobile,                                               // 使用移动仓库
-		Host:                        NewHostConfigOption(cfg.HostOption, cfg.HostConfig),          // 配置网络主机
-		Routing:                     NewRoutingConfigOption(cfg.RoutingOption, cfg.RoutingConfig), // 配置路由
-		ExtraOpts:                   cfg.ExtraOpts,                                                // 设置额外选项(如pubsub)
+	if serr := n.restartServers(n.mobile()); serr != nil {
+		return fmt.Errorf("unable to switch node state: %w, %s", err, serr.Error())
 	}
 
-	// 创建IPFS核心节点
-	inode, err := ipfs_core.NewNode(ctx, buildcfg)
+	return fmt.Errorf("unable to switch node state: %w", err)
+}
+
+// start创建IpfsMobile并挂载流处理器、节点事件监听器和PubSub订阅，调用方必须持有muState(NewNode除外)
+// API和网关由调用方通过restartServers重新启动
+func (n *Node) start(online bool) error {
+	// 配置IPFS节点
+	// IpfsMobile关闭时会关闭仓库，而切换在线状态时仓库需要继续使用，仓库由Node在Close时关闭
+	// 挂起时通过suspendSwitch降低连接管理器的水位并暂停reprovider和DHT刷新
+	sw := &suspendSwitch{}
+
+	// 获取仓库配置
+	repoCfg, err := n.repo.mr.Config()
 	if err != nil {
-		// 注释掉了解锁仓库的代码
-		// unlockRepo(repoPath)
-		return nil, fmt.Errorf("failed to init ipfs node: %s", err)
-	}
-
-	// 创建命令上下文
-	// 注释表明这可能不是初始化的最佳方式
-	cctx := ipfs_oldcmds.Context{
-		ConfigRoot: cfg.RepoMobile.Path(),  // 配置根路径
-		ReqLog:     &ipfs_oldcmds.ReqLog{}, // 请求日志
-		ConstructNode: func() (*ipfs_core.IpfsNode, error) { // 节点构造函数
-			return inode, nil
+		return fmt.Errorf("unable to get repo config: %w", err)
+	}
+
+	routingOption, err := sw.routingOption(repoCfg.Routing.Type.WithDefault("auto"))
+	if err != nil {
+		return err
+	}
+
+	ipfscfg := &IpfsConfig{
+		HostConfig: &HostConfig{
+			Options: append(append([]p2p.Option{}, n.hostOpts...), sw.connManagerOption()),
 		},
+		RoutingOption: routingOption,
+		// 存储看门狗通过storageGuard在剩余空间不足时拒绝写入新的块
+		RepoMobile: NewRepoMobile(n.repo.mr.Path(), newGuardedRepo(keepOpenRepo{Repo: n.repo.identityRepo(), muConfig: &n.repo.mr.muConfig}, &n.storage)),
+		ExtraOpts: map[string]bool{
+			"pubsub": true, // 默认启用实验性的pubsub功能
+			"ipnsps": true, // 默认启用通过pubsub分发IPNS记录
+		},
+		Offline: !online,
+	}
+
+	// mDNS由绑定层的ipfsutil服务接管
+	// 暂时禁用mDNS，避免NewIpfsMobile启动kubo内置的mDNS服务
+	mdnsEnabled := online && repoCfg.Discovery.MDNS.Enabled
+	if mdnsEnabled {
+		if err := setRepoMDNS(n.repo.mr, false); err != nil {
+			return fmt.Errorf("unable to ApplyPatchs to disable mDNS: %w", err)
+		}
+	}
+
+	mnode, err := NewIpfsMobile(n.ctx, ipfscfg)
+
+	// 无论节点是否创建成功，都恢复mDNS配置
+	if mdnsEnabled {
+		if perr := setRepoMDNS(n.repo.mr, true); perr != nil && err == nil {
+			mnode.Close()
+			err = fmt.Errorf("unable to ApplyPatchs to enable mDNS: %w", perr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if mdnsEnabled {
+		if err := n.startMDNS(mnode); err != nil {
+			mnode.Close()
+			return err
+		}
+	}
+
+	n.muMobile.Lock()
+	n.ipfsMobile = mnode
+	n.online = online
+	n.muMobile.Unlock()
+
+	// 新节点没有挂起
+	n.suspended = nil
+	n.suspendSwitch = sw
+
+	if h := mnode.PeerHost(); h != nil {
+		n.applyStreamHandlers(h)
+
+		n.muPeerEvents.Lock()
+		if err := n.subscribePeerEvents(h); err != nil {
+			n.logger.Warn("unable to forward peer events", zap.Error(err))
+		}
+		n.muPeerEvents.Unlock()
+
+		n.attachSubscriptions(mnode)
+	}
+
+	return nil
+}
+
+// stop按照与启动相反的顺序停止由绑定层管理的服务并关闭IpfsMobile，仓库保持打开
+// 调用前必须停止存储看门狗(见pauseStorageWatchdog)
+func (n *Node) stop() error {
+	n.closeListeners()
+
+	n.detachSubscriptions()
+
+	n.muPeerEvents.Lock()
+	n.closePeerEvents(true)
+	n.muPeerEvents.Unlock()
+
+	n.stopMDNS()
+
+	return n.mobile().Close()
+}
+
+// Close按照与启动相反的顺序关闭节点
+// 先关闭API监听器，再停止mDNS服务，然后关闭IPFS节点，最后关闭仓库
+func (n *Node) Close() error {
+	n.muState.Lock()
+	defer n.muState.Unlock()
+
+	// 先停止看门狗，避免垃圾回收访问正在关闭的节点
+	n.StopStorageWatchdog()
+
+	err := n.stop()
+	n.cancel()
+
+	removeNetDriver(n.netDriver)
+
+	if cerr := n.repo.mr.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// ServeAPIMultiaddr在给定的多地址上提供kubo HTTP RPC API
+// 支持应用沙盒内的Unix套接字(/unix/...)和本地回环TCP(/ip4/127.0.0.1/tcp/0)
+// RPC API可以读取私钥、修改配置，其他地址只有在NodeConfig.SetAllowRemoteAPI(true)
+// 或者仓库配置了API.Authorizations时才允许
+// 返回实际绑定的多地址(例如端口为0时分配的随机端口)，监听器会在Close时关闭
+func (n *Node) ServeAPIMultiaddr(smaddr string) (string, error) {
+	if err := n.checkAPIAddr(smaddr); err != nil {
+		return "", err
+	}
+
+	return n.serve(smaddr, "api", (*IpfsMobile).Serve)
+}
+
+// checkAPIAddr确认API可以在smaddr上监听
+func (n *Node) checkAPIAddr(smaddr string) error {
+	maddr, err := ma.NewMultiaddr(smaddr)
+	if err != nil {
+		return fmt.Errorf("invalid multiaddr `%s`: %w", smaddr, err)
+	}
+
+	if _, err := maddr.ValueForProtocol(ma.P_UNIX); err == nil || manet.IsIPLoopback(maddr) {
+		return nil
+	}
+
+	if n.allowRemoteAPI {
+		return nil
+	}
+
+	cfg, err := n.repo.mr.Config()
+	if err != nil {
+		return err
+	}
+	if len(cfg.API.Authorizations) > 0 {
+		return nil
+	}
+
+	return fmt.Errorf("refusing to serve the API on non-loopback address `%s`: configure API.Authorizations or allow remote API in NodeConfig", smaddr)
+}
+
+// ServeGateway在给定的多地址上提供HTTP网关，供应用内的WebView直接加载/ipfs/<cid>内容
+// smaddr为空时监听本地回环地址上的随机空闲端口，返回实际绑定的多地址
+// writable为true时允许通过POST /ipfs/上传内容，请求必须带有GatewayWriteToken返回的令牌，
+// 避免WebView中加载的页面向节点写入内容
+// 监听器会在Close时关闭
+func (n *Node) ServeGateway(smaddr string, writable bool) (string, error) {
+	if smaddr == "" {
+		smaddr = defaultGatewayAddr
+	}
+
+	token := ""
+	if writable {
+		token = n.gatewayToken
+	}
+
+	return n.serve(smaddr, "gateway", func(im *IpfsMobile, l net.Listener) error {
+		return im.ServeGateway(l, token)
+	})
+}
+
+// GatewayWriteToken返回向可写网关上传内容时使用的令牌，每个节点随机生成
+// 上传请求需要带有"Authorization: Bearer <令牌>"头
+func (n *Node) GatewayWriteToken() string {
+	return n.gatewayToken
+}
+
+// serve在给定的多地址上启动服务并记录下来，以便切换在线状态后在同一地址上重新启动
+func (n *Node) serve(smaddr string, name string, serve func(im *IpfsMobile, l net.Listener) error) (string, error) {
+	ml, err := n.listen(smaddr)
+	if err != nil {
+		return "", err
+	}
+
+	s := &server{
+		maddr: ml.Multiaddr().String(),
+		serve: serve,
+		name:  name,
 	}
 
-	// 返回创建的移动IPFS节点
-	return &IpfsMobile{
-		commandCtx: cctx,           // 命令上下文
-		IpfsNode:   inode,          // IPFS核心节点
-		Repo:       cfg.RepoMobile, // 仓库引用
-	}, nil
+	n.muListeners.Lock()
+	n.servers = append(n.servers, s)
+	n.muListeners.Unlock()
+
+	n.startServer(s, n.mobile(), ml)
+
+	return s.maddr, nil
 }
 
-// fillDefault为配置填充默认值
-// 确保配置对象包含所有必需的字段
-func (c *IpfsConfig) fillDefault() error {
-	// 仓库是必需的，不能为空
-	if c.RepoMobile == nil {
-		return fmt.Errorf("repo cannot be nil")
+// restartServers在IpfsMobile上重新启动之前的服务，返回无法在原来的地址上重新监听的服务的错误
+func (n *Node) restartServers(im *IpfsMobile) error {
+	n.muListeners.Lock()
+	servers := append([]*server{}, n.servers...)
+	n.muListeners.Unlock()
+
+	var errs []error
+	for _, s := range servers {
+		ml, err := n.listen(s.maddr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to restart %s server: %w", s.name, err))
+			continue
+		}
+
+		n.startServer(s, im, ml)
 	}
 
-	// 如果额外选项为空，创建空映射
-	if c.ExtraOpts == nil {
-		c.ExtraOpts = make(map[string]bool)
+	return errors.Join(errs...)
+}
+
+// closeListeners关闭所有服务的监听器，服务的记录会保留以便之后重新启动
+func (n *Node) closeListeners() {
+	n.muListeners.Lock()
+	defer n.muListeners.Unlock()
+
+	for _, l := range n.listeners {
+		l.Close()
+	}
+	n.listeners = nil
+}
+
+func (n *Node) startServer(s *server, im *IpfsMobile, ml manet.Listener) {
+	go func(l net.Listener) {
+		err := s.serve(im, l)
+
+		// 监听器或节点关闭属于正常退出
+		select {
+		case <-im.Process.Closing():
+			return
+		default:
+		}
+
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			n.logger.Error("server stopped", zap.String("name", s.name), zap.Error(err))
+		}
+	}(manet.NetListener(ml))
+}
+
+// listen在给定的多地址上创建监听器并将其登记到节点，以便Close时统一关闭
+func (n *Node) listen(smaddr string) (manet.Listener, error) {
+	maddr, err := ma.NewMultiaddr(smaddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multiaddr `%s`: %w", smaddr, err)
 	}
 
-	// 默认使用DHT(分布式哈希表)作为路由选项
-	if c.RoutingOption == nil {
-		c.RoutingOption = ipfs_p2p.DHTOption
+	// 应用被杀死后可能残留旧的套接字文件，监听前先将其移除
+	if sockpath, err := maddr.ValueForProtocol(ma.P_UNIX); err == nil {
+		if fi, err := os.Stat(sockpath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(sockpath); err != nil {
+				return nil, fmt.Errorf("unable to remove stale socket `%s`: %w", sockpath, err)
+			}
+		}
 	}
 
-	// 如果没有路由配置，创建默认配置
-	if c.RoutingConfig == nil {
-		c.RoutingConfig = &RoutingConfig{}
+	ml, err := manet.Listen(maddr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on `%s`: %w", smaddr, err)
 	}
 
-	// 默认使用标准主机选项
-	if c.HostOption == nil {
-		c.HostOption = ipfs_p2p.DefaultHostOption
+	n.muListeners.Lock()
+	n.listeners = append(n.listeners, ml)
+	n.muListeners.Unlock()
+
+	return ml, nil
+}
+
+// startMDNS启动mDNS服务，服务运行期间持有多播锁
+func (n *Node) startMDNS(mnode *IpfsMobile) error {
+	if n.mdnsLocker != nil {
+		n.mdnsLocker.Lock()
+		n.mdnsLocked = true
 	}
 
-	// 如果没有主机配置，创建默认配置
-	if c.HostConfig == nil {
-		c.HostConfig = &HostConfig{}
+	var err error
+	n.mdnsService, err = startMDNSService(n.ctx, n.logger, mnode)
+	if n.mdnsService == nil && n.mdnsLocked {
+		n.mdnsLocker.Unlock()
+		n.mdnsLocked = false
 	}
 
+	return err
+}
+
+// stopMDNS停止mDNS服务并释放多播锁
+func (n *Node) stopMDNS() {
+	if n.mdnsService != nil {
+		n.mdnsService.Close()
+		n.mdnsService = nil
+	}
+
+	if n.mdnsLocked {
+		n.mdnsLocker.Unlock()
+		n.mdnsLocked = false
+	}
+}
+
+// setRepoMDNS修改仓库配置中的mDNS开关
+func setRepoMDNS(mr *RepoMobile, enabled bool) error {
+	return mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		cfg.Discovery.MDNS.Enabled = enabled
+		return nil
+	})
+}
+
+// startMDNSService在节点主机上创建并启动ipfsutil的mDNS服务
+// 如果没有可用的多播接口，不启动服务并返回nil
+func startMDNSService(ctx context.Context, logger *zap.Logger, mnode *IpfsMobile) (p2p_mdns.Service, error) {
+	h := mnode.PeerHost()
+	mdnslogger := logger.Named("mdns")
+
+	// 创建发现处理器和mDNS服务
+	dh := ipfsutil.DiscoveryHandler(ctx, mdnslogger, h)
+	mdnsService := ipfsutil.NewMdnsService(mdnslogger, h, ipfsutil.MDNSServiceName, dh)
+
+	// 获取多播接口
+	ifaces, err := ipfsutil.GetMulticastInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("unable to GetMulticastInterfaces: %w", err)
+	}
+
+	// 如果找到多播接口，启动mDNS服务
+	if len(ifaces) > 0 {
+		mdnslogger.Info("starting mdns")
+		if err := mdnsService.Start(); err != nil {
+			mdnsService.Close()
+			return nil, fmt.Errorf("unable to start mdns service: %w", err)
+		}
+		return mdnsService, nil
+	}
+
+	mdnslogger.Error("unable to start mdns service, no multicast interfaces found")
+	return nil, nil
+}
+
+// keepOpenRepo在关闭时不关闭底层仓库，使切换在线状态时重建的节点可以继续使用同一个仓库
+// 每次启动都会创建新的RepoMobile，kubo通过节点写入配置时使用Repo的配置锁，
+// 与Repo.SetConfigKey、ApplyProfile等的读取-修改-写入依次进行
+type keepOpenRepo struct {
+	ipfs_repo.Repo
+	muConfig *sync.Mutex
+}
+
+func (keepOpenRepo) Close() error {
 	return nil
 }
 
-// PeerHost返回节点的P2P网络主机
-// 允许访问底层网络功能
-func (im *IpfsMobile) PeerHost() p2p_host.Host {
-	return im.IpfsNode.PeerHost
+func (r keepOpenRepo) SetConfig(cfg *ipfs_config.Config) error {
+	r.muConfig.Lock()
+	defer r.muConfig.Unlock()
+
+	return r.Repo.SetConfig(cfg)
+}
+
+func (r keepOpenRepo) SetConfigKey(key string, value interface{}) error {
+	r.muConfig.Lock()
+	defer r.muConfig.Unlock()
+
+	return r.Repo.SetConfigKey(key, value)
 }
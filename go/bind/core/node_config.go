@@ -1,11 +1,65 @@
 package core
 
+import "time"
+
+// defaultSuspendTimeout是Suspend和Resume的默认时限
+// iOS在应用进入后台后只给出几秒钟的执行时间
+const defaultSuspendTimeout = 5 * time.Second
+
+// NodeConfig保存创建节点时由原生平台提供的驱动和选项
 type NodeConfig struct {
 	bleDriver        ProximityDriver
 	netDriver        NativeNetDriver
 	mdnsLockerDriver NativeMDNSLockerDriver
+	keystoreDriver   NativeKeystoreDriver
+
+	allowRemoteAPI bool
+
+	suspendTimeout time.Duration
 }
 
 func NewNodeConfig() *NodeConfig {
-	return &NodeConfig{}
+	return &NodeConfig{
+		suspendTimeout: defaultSuspendTimeout,
+	}
+}
+
+// SetBleDriver设置原生BLE驱动，节点启动时会用它注册邻近传输
+func (c *NodeConfig) SetBleDriver(driver ProximityDriver) {
+	c.bleDriver = driver
+}
+
+// SetNetDriver设置原生网络驱动，用于替代Go标准库获取网络接口和地址
+func (c *NodeConfig) SetNetDriver(driver NativeNetDriver) {
+	c.netDriver = driver
+}
+
+// SetMDNSLockerDriver设置mDNS锁驱动(如Android的MulticastLock)
+// mDNS服务运行期间会一直持有该锁
+func (c *NodeConfig) SetMDNSLockerDriver(driver NativeMDNSLockerDriver) {
+	c.mdnsLockerDriver = driver
+}
+
+// SetKeystoreDriver设置原生密钥库驱动(如iOS Keychain、Android Keystore)
+// 设置后节点的私钥和IPNS密钥保存在原生密钥库中，仓库配置只保存引用
+// 仓库中的明文私钥会在创建节点时迁移到原生密钥库，迁移后必须始终使用同一个驱动
+func (c *NodeConfig) SetKeystoreDriver(driver NativeKeystoreDriver) {
+	c.keystoreDriver = driver
+}
+
+// SetAllowRemoteAPI设置ServeAPIMultiaddr是否可以在本地回环和Unix套接字以外的地址上监听
+// 局域网中的任何设备都可以通过RPC API完全控制节点，只应在调试时开启，否则应配置API.Authorizations
+func (c *NodeConfig) SetAllowRemoteAPI(allow bool) {
+	c.allowRemoteAPI = allow
+}
+
+// SetSuspendTimeout设置Suspend和Resume必须完成的时限，单位为毫秒
+// 小于等于0时使用默认值(5秒)
+func (c *NodeConfig) SetSuspendTimeout(timeoutMs int64) {
+	if timeoutMs <= 0 {
+		c.suspendTimeout = defaultSuspendTimeout
+		return
+	}
+
+	c.suspendTimeout = time.Duration(timeoutMs) * time.Millisecond
 }
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marssuren/gomobile_ipfs_0/go/pkg/ipfsutil"
+)
+
+type testMDNSLocker struct {
+	mu      sync.Mutex
+	locks   int
+	unlocks int
+}
+
+func (l *testMDNSLocker) Lock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.locks++
+}
+
+func (l *testMDNSLocker) Unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.unlocks++
+}
+
+// held返回多播锁当前是否被持有
+func (l *testMDNSLocker) held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.locks > l.unlocks
+}
+
+type testNetDriver struct {
+	err error
+}
+
+func (d *testNetDriver) InterfaceAddrs() (*NetAddrs, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	addrs := NewNetAddrs()
+	addrs.AppendAddr("127.0.0.1/8")
+	return addrs, nil
+}
+
+func (d *testNetDriver) Interfaces() (*NetInterfaces, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	lo := NewNetInterface(1, 65536, "lo")
+	lo.Addrs.AppendAddr("127.0.0.1/8")
+	lo.AddFlag(NetFlagUp)
+	lo.AddFlag(NetFlagLoopback)
+	lo.AddFlag(NetFlagMulticast)
+
+	ifaces := NewNetInterfaces()
+	ifaces.AppendInterface(lo)
+	return ifaces, nil
+}
+
+func newTestMDNSConfig(t *testing.T) *Config {
+	t.Helper()
+
+	cfg := newTestConfig(t)
+	if err := cfg.SetKey("Discovery.MDNS.Enabled", []byte("true")); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestNodeConfigSuspendTimeout(t *testing.T) {
+	c := NewNodeConfig()
+	if c.suspendTimeout != defaultSuspendTimeout {
+		t.Fatalf("default suspend timeout = %v", c.suspendTimeout)
+	}
+
+	c.SetSuspendTimeout(1500)
+	if c.suspendTimeout != 1500*time.Millisecond {
+		t.Fatalf("suspend timeout = %v", c.suspendTimeout)
+	}
+
+	c.SetSuspendTimeout(-1)
+	if c.suspendTimeout != defaultSuspendTimeout {
+		t.Fatalf("negative timeout not reset: %v", c.suspendTimeout)
+	}
+}
+
+func TestNodeConfigDrivers(t *testing.T) {
+	defaultDriver := ipfsutil.GetNetDriver()
+
+	locker := &testMDNSLocker{}
+	config := NewNodeConfig()
+	config.SetNetDriver(&testNetDriver{})
+	config.SetMDNSLockerDriver(locker)
+
+	n := newTestNodeWithConfig(t, newTestMDNSConfig(t), config)
+
+	// 节点使用原生网络驱动获取网络接口
+	ifaces, err := ipfsutil.GetMulticastInterfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ifaces) != 1 || ifaces[0].Name != "lo" || ifaces[0].Flags&net.FlagMulticast == 0 {
+		t.Fatalf("multicast interfaces = %+v", ifaces)
+	}
+
+	// 只在mDNS服务运行期间持有多播锁
+	if locker.held() != (n.mdnsService != nil) {
+		t.Fatalf("multicast lock held = %v, mdns running = %v", locker.held(), n.mdnsService != nil)
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if locker.held() {
+		t.Fatal("multicast lock held while offline")
+	}
+
+	if err := n.GoOnline(); err != nil {
+		t.Fatal(err)
+	}
+	if locker.held() != (n.mdnsService != nil) {
+		t.Fatalf("multicast lock held = %v, mdns running = %v", locker.held(), n.mdnsService != nil)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if locker.held() {
+		t.Fatal("multicast lock held after close")
+	}
+	if ipfsutil.GetNetDriver() != defaultDriver {
+		t.Fatal("net driver not restored after close")
+	}
+}
+
+func TestNetDriverRestoredOnClose(t *testing.T) {
+	defaultDriver := ipfsutil.GetNetDriver()
+
+	config := NewNodeConfig()
+	config.SetNetDriver(&testNetDriver{})
+	a := newTestNodeWithConfig(t, nil, config)
+	b := newTestNodeWithConfig(t, nil, config)
+	c := newTestNode(t, nil)
+
+	// ipfsutil使用最后创建的节点的驱动
+	if ipfsutil.GetNetDriver() != b.netDriver {
+		t.Fatal("net driver of the last node is not used")
+	}
+
+	// 没有设置驱动的节点不影响驱动
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ipfsutil.GetNetDriver() != b.netDriver {
+		t.Fatal("closing a node without a driver changed the net driver")
+	}
+
+	// 先关闭先创建的节点，仍然使用后创建的节点的驱动
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ipfsutil.GetNetDriver() != b.netDriver {
+		t.Fatal("closing an older node replaced the net driver")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ipfsutil.GetNetDriver() != defaultDriver {
+		t.Fatal("net driver not restored after all nodes closed")
+	}
+
+	// 重复关闭不影响驱动
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ipfsutil.GetNetDriver() != defaultDriver {
+		t.Fatal("closing a node twice changed the net driver")
+	}
+}
+
+func TestMDNSLockerReleasedOnError(t *testing.T) {
+	defaultDriver := ipfsutil.GetNetDriver()
+
+	locker := &testMDNSLocker{}
+	config := NewNodeConfig()
+	config.SetNetDriver(&testNetDriver{err: errors.New("no network access")})
+	config.SetMDNSLockerDriver(locker)
+
+	path := t.TempDir()
+	if err := InitRepo(path, newTestMDNSConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := NewNode(r, config); err == nil {
+		t.Fatal("NewNode should fail when mDNS cannot resolve interfaces")
+	}
+	if locker.locks == 0 || locker.held() {
+		t.Fatalf("multicast lock not released: %d locks, %d unlocks", locker.locks, locker.unlocks)
+	}
+	if ipfsutil.GetNetDriver() != defaultDriver {
+		t.Fatal("net driver not restored after NewNode failed")
+	}
+
+	// 失败时恢复了仓库中的mDNS配置
+	v, err := r.GetConfigKey("Discovery.MDNS.Enabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "true" {
+		t.Fatalf("Discovery.MDNS.Enabled = %s", v)
+	}
+}
@@ -0,0 +1,293 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func dialMultiaddr(t *testing.T, smaddr string) error {
+	t.Helper()
+
+	maddr, err := ma.NewMultiaddr(smaddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, _ := maddr.ValueForProtocol(ma.P_IP4)
+	port, _ := maddr.ValueForProtocol(ma.P_TCP)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestNewNode(t *testing.T) {
+	n := newTestNode(t, nil)
+	if !n.IsOnline() {
+		t.Fatal("new node is not online")
+	}
+	if n.mobile().PeerHost() == nil {
+		t.Fatal("online node has no host")
+	}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.AddBytes([]byte("closed"), true); err == nil {
+		t.Fatal("AddBytes on a closed node should fail")
+	}
+}
+
+func TestNewNodeErrors(t *testing.T) {
+	if _, err := NewNode(nil, nil); err == nil {
+		t.Fatal("NewNode without a repo should fail")
+	}
+
+	path := t.TempDir()
+	if err := InitRepo(path, newTestConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewNode(r, nil); err == nil {
+		t.Fatal("NewNode with a closed repo should fail")
+	}
+}
+
+func TestGoOfflineOnline(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+	bID := b.mobile().PeerHost().ID().String()
+
+	events := &testPeerEvents{}
+	if err := a.SetPeerEventListener(events); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &testPubSubHandler{msgs: make(chan string, 16)}
+	sub, err := a.PubSubSubscribe("test-topic", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel()
+
+	gw, err := a.ServeGateway("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestNodes(t, a, b)
+	waitFor(t, "connected event", func() bool { return events.has(PeerEventConnected, bID) })
+
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if a.IsOnline() {
+		t.Fatal("node is still online")
+	}
+	if a.mobile().PeerHost() != nil {
+		t.Fatal("offline node has a host")
+	}
+	waitFor(t, "disconnected event", func() bool { return events.has(PeerEventDisconnected, bID) })
+
+	if err := dialMultiaddr(t, gw); err != nil {
+		t.Fatalf("gateway not available while offline: %v", err)
+	}
+
+	// 离线时仓库仍然可用
+	if _, err := a.AddBytes([]byte("offline content"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.GoOnline(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsOnline() {
+		t.Fatal("node is not online")
+	}
+	if err := dialMultiaddr(t, gw); err != nil {
+		t.Fatalf("gateway not available after going online: %v", err)
+	}
+
+	// 订阅在新的节点上恢复
+	connectTestNodes(t, b, a)
+	waitFor(t, "restored subscription", func() bool {
+		if err := b.PubSubPublish("test-topic", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case msg := <-handler.msgs:
+			return msg == "hello"
+		default:
+			return false
+		}
+	})
+}
+
+func TestGoOfflineRestartServerError(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// 切换期间API原来的地址被其他程序占用
+	n.servers = append(n.servers, &server{
+		maddr: "/ip4/127.0.0.1/tcp/" + portOf(l.Addr()),
+		serve: (*IpfsMobile).Serve,
+		name:  "api",
+	})
+
+	if err := n.GoOffline(); err == nil {
+		t.Fatal("GoOffline should return the bind error")
+	}
+	if n.IsOnline() {
+		t.Fatal("node should be offline even if a server could not be restarted")
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.GoOnline(); err == nil {
+		t.Fatal("GoOnline on a closed node should fail")
+	}
+}
+
+// apiStatus向API发送/api/v0/id请求并返回状态码
+func apiStatus(t *testing.T, client *http.Client, url string) int {
+	t.Helper()
+
+	resp, err := client.Post(url+"/api/v0/id", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestServeAPIMultiaddr(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	maddr, err := n.ServeAPIMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := ma.NewMultiaddr(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := addr.ValueForProtocol(ma.P_TCP)
+	if port == "0" {
+		t.Fatal("the bound port was not returned")
+	}
+	if status := apiStatus(t, http.DefaultClient, "http://127.0.0.1:"+port); status != http.StatusOK {
+		t.Fatalf("id over tcp: status %d", status)
+	}
+
+	// 路径过长时无法创建Unix套接字，不使用t.TempDir
+	dir, err := os.MkdirTemp("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "api.sock")
+
+	if _, err := n.ServeAPIMultiaddr("/unix" + sock); err != nil {
+		t.Fatal(err)
+	}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	if status := apiStatus(t, unixClient, "http://unix"); status != http.StatusOK {
+		t.Fatalf("id over unix socket: status %d", status)
+	}
+}
+
+func TestServeAPIMultiaddrRemote(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if _, err := n.ServeAPIMultiaddr("/ip4/0.0.0.0/tcp/0"); err == nil {
+		t.Fatal("serving the API on all interfaces should require an opt-in")
+	}
+	if _, err := n.ServeAPIMultiaddr("not a multiaddr"); err == nil {
+		t.Fatal("invalid multiaddr should fail")
+	}
+
+	// 配置了API.Authorizations时由kubo检查令牌
+	if err := n.repo.SetConfigKey("API.Authorizations", []byte(`{"app":{"AuthSecret":"bearer:secret","AllowedPaths":["/api/v0/id"]}}`)); err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := n.ServeAPIMultiaddr("/ip4/0.0.0.0/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := ma.NewMultiaddr(maddr)
+	port, _ := addr.ValueForProtocol(ma.P_TCP)
+	if status := apiStatus(t, http.DefaultClient, "http://127.0.0.1:"+port); status != http.StatusForbidden {
+		t.Fatalf("id without a token: status %d, want %d", status, http.StatusForbidden)
+	}
+
+	config := NewNodeConfig()
+	config.SetAllowRemoteAPI(true)
+	m := newTestNodeWithConfig(t, nil, config)
+	if _, err := m.ServeAPIMultiaddr("/ip4/0.0.0.0/tcp/0"); err != nil {
+		t.Fatalf("opted in remote API: %v", err)
+	}
+}
+
+func TestNodeRepoConfigLock(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	// kubo通过节点写入配置时与Repo的读取-修改-写入使用同一个锁
+	n.repo.mr.muConfig.Lock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- n.mobile().Repo.SetConfigKey("Swarm.ConnMgr.LowWater", 7)
+	}()
+
+	select {
+	case err := <-done:
+		n.repo.mr.muConfig.Unlock()
+		t.Fatalf("config written while the repo config lock is held: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	n.repo.mr.muConfig.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// 切换在线状态后重建的节点使用同一个锁
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.repo.SetConfigKey("Swarm.ConnMgr.LowWater", []byte("8")); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.mobile().Repo.SetConfigKey("Swarm.ConnMgr.HighWater", 300); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := n.repo.GetConfigKey("Swarm.ConnMgr.LowWater"); string(v) != "8" {
+		t.Fatalf("Swarm.ConnMgr.LowWater = %s", v)
+	}
+}
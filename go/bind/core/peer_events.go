@@ -0,0 +1,205 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	p2p_host "github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"go.uber.org/zap"
+)
+
+// 节点事件类型
+const (
+	PeerEventConnected        = "connected"         // 与节点建立了连接
+	PeerEventDisconnected     = "disconnected"      // 与节点的所有连接都已断开
+	PeerEventIdentified       = "identified"        // 完成了节点识别(identify)
+	PeerEventProtocolsAdded   = "protocols_added"   // 节点新增了支持的协议
+	PeerEventProtocolsRemoved = "protocols_removed" // 节点移除了支持的协议
+)
+
+// PeerEvent是交给原生平台的节点事件
+// 断开连接时没有可用的连接，Transport、Multiaddr和Direction为空
+type PeerEvent struct {
+	Type      string      // 事件类型，见PeerEvent*常量
+	PeerID    string      // 节点ID
+	Transport string      // 传输名称，例如"tcp"、"quic-v1"或BLE等近场传输的协议名
+	Multiaddr string      // 连接的远端多地址
+	Direction string      // 连接方向:"inbound"、"outbound"或"unknown"
+	Protocols *StringList // 识别完成时为节点支持的协议，协议变更时为新增或移除的协议
+}
+
+// PeerEventListener由原生平台实现，用于接收节点连接事件
+// 事件在专用的goroutine上按顺序回调
+type PeerEventListener interface {
+	HandlePeerEvent(e *PeerEvent)
+}
+
+// SetPeerEventListener设置节点事件监听器，替换之前设置的监听器
+// listener为nil时停止转发事件，离线时设置的监听器会在节点上线后开始接收事件
+func (n *Node) SetPeerEventListener(listener PeerEventListener) error {
+	n.muPeerEvents.Lock()
+	defer n.muPeerEvents.Unlock()
+
+	n.peerEventListener = listener
+	return n.subscribePeerEvents(n.mobile().PeerHost())
+}
+
+// subscribePeerEvents在主机的事件总线上订阅节点事件并转发给当前的监听器
+// 调用方必须持有muPeerEvents
+func (n *Node) subscribePeerEvents(h p2p_host.Host) error {
+	n.closePeerEvents(false)
+
+	listener := n.peerEventListener
+	if listener == nil || h == nil {
+		return nil
+	}
+
+	sub, err := h.EventBus().Subscribe([]interface{}{
+		new(event.EvtPeerConnectednessChanged),
+		new(event.EvtPeerIdentificationCompleted),
+		new(event.EvtPeerProtocolsUpdated),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to subscribe to peer events: %w", err)
+	}
+
+	stop := make(chan bool, 1)
+	n.peerEventStop = stop
+
+	logger := n.logger.Named("peerevents")
+	go func() {
+		defer sub.Close()
+
+		// 已经通知监听器的连接，主机关闭时为它们补发断开事件
+		connected := map[peer.ID]struct{}{}
+		for {
+			select {
+			case e, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+
+				if evt, ok := e.(event.EvtPeerConnectednessChanged); ok {
+					switch evt.Connectedness {
+					case network.Connected, network.Limited:
+						connected[evt.Peer] = struct{}{}
+					case network.NotConnected:
+						delete(connected, evt.Peer)
+					}
+				}
+
+				for _, pe := range peerEvents(logger, h, e) {
+					listener.HandlePeerEvent(pe)
+				}
+			case disconnect := <-stop:
+				if disconnect {
+					for p := range connected {
+						listener.HandlePeerEvent(&PeerEvent{Type: PeerEventDisconnected, PeerID: p.String()})
+					}
+				}
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// closePeerEvents停止转发节点事件，调用方必须持有muPeerEvents
+// disconnect为true时主机即将关闭，不会再发出断开事件，为仍然连接的节点补发断开事件
+func (n *Node) closePeerEvents(disconnect bool) {
+	if n.peerEventStop != nil {
+		n.peerEventStop <- disconnect
+		n.peerEventStop = nil
+	}
+}
+
+// peerEvents将事件总线上的事件转换为原生平台使用的事件
+func peerEvents(logger *zap.Logger, h p2p_host.Host, e interface{}) []*PeerEvent {
+	switch evt := e.(type) {
+	case event.EvtPeerConnectednessChanged:
+		switch evt.Connectedness {
+		case network.Connected, network.Limited:
+			// 连接状态事件不携带连接，使用该节点的第一个连接
+			pe := &PeerEvent{Type: PeerEventConnected, PeerID: evt.Peer.String()}
+			if conns := h.Network().ConnsToPeer(evt.Peer); len(conns) > 0 {
+				fillConnInfo(pe, conns[0])
+			}
+			return []*PeerEvent{pe}
+		case network.NotConnected:
+			return []*PeerEvent{{Type: PeerEventDisconnected, PeerID: evt.Peer.String()}}
+		}
+	case event.EvtPeerIdentificationCompleted:
+		pe := &PeerEvent{
+			Type:      PeerEventIdentified,
+			PeerID:    evt.Peer.String(),
+			Protocols: protocolList(evt.Protocols),
+		}
+		if evt.Conn != nil {
+			fillConnInfo(pe, evt.Conn)
+		}
+		return []*PeerEvent{pe}
+	case event.EvtPeerProtocolsUpdated:
+		var pes []*PeerEvent
+		if len(evt.Added) > 0 {
+			pes = append(pes, protocolsEvent(h, PeerEventProtocolsAdded, evt.Peer, evt.Added))
+		}
+		if len(evt.Removed) > 0 {
+			pes = append(pes, protocolsEvent(h, PeerEventProtocolsRemoved, evt.Peer, evt.Removed))
+		}
+		return pes
+	default:
+		logger.Debug("unexpected peer event", zap.Any("event", e))
+	}
+
+	return nil
+}
+
+func protocolsEvent(h p2p_host.Host, typ string, p peer.ID, protos []protocol.ID) *PeerEvent {
+	pe := &PeerEvent{
+		Type:      typ,
+		PeerID:    p.String(),
+		Protocols: protocolList(protos),
+	}
+	if conns := h.Network().ConnsToPeer(p); len(conns) > 0 {
+		fillConnInfo(pe, conns[0])
+	}
+
+	return pe
+}
+
+// fillConnInfo使用连接信息填充事件的传输名称、多地址和方向
+func fillConnInfo(pe *PeerEvent, c network.Conn) {
+	maddr := c.RemoteMultiaddr()
+	pe.Multiaddr = maddr.String()
+	pe.Direction = directionName(c.Stat().Direction)
+	pe.Transport = c.ConnState().Transport
+
+	// 近场传输(BLE等)没有设置传输名称，使用多地址的第一个协议名
+	if pe.Transport == "" && len(maddr) > 0 {
+		pe.Transport = maddr[0].Protocol().Name
+	}
+}
+
+func directionName(d network.Direction) string {
+	switch d {
+	case network.DirInbound:
+		return "inbound"
+	case network.DirOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
+
+func protocolList(protos []protocol.ID) *StringList {
+	items := make([]string, len(protos))
+	for i, p := range protos {
+		items[i] = string(p)
+	}
+
+	return newStringList(items)
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"go.uber.org/zap"
+)
+
+type testPeerEvents struct {
+	mu     sync.Mutex
+	events []*PeerEvent
+}
+
+func (l *testPeerEvents) HandlePeerEvent(e *PeerEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, e)
+}
+
+func (l *testPeerEvents) has(typ string, peerID string) bool {
+	return l.find(typ, peerID) != nil
+}
+
+// find返回第一个匹配的事件
+func (l *testPeerEvents) find(typ string, peerID string) *PeerEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.events {
+		if e.Type == typ && e.PeerID == peerID {
+			return e
+		}
+	}
+	return nil
+}
+
+func (l *testPeerEvents) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.events)
+}
+
+func TestPeerEventListener(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+	bID := b.mobile().PeerHost().ID().String()
+
+	events := &testPeerEvents{}
+	if err := a.SetPeerEventListener(events); err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestNodes(t, a, b)
+	waitFor(t, "connected event", func() bool { return events.has(PeerEventConnected, bID) })
+
+	e := events.find(PeerEventConnected, bID)
+	if e.Transport != "tcp" || e.Direction != "outbound" || e.Multiaddr == "" {
+		t.Fatalf("unexpected connected event: %+v", e)
+	}
+
+	waitFor(t, "identified event", func() bool { return events.has(PeerEventIdentified, bID) })
+	if e := events.find(PeerEventIdentified, bID); e.Protocols.Count() == 0 {
+		t.Fatalf("identified event without protocols: %+v", e)
+	}
+
+	// 远端注册新协议后通过identify push通知
+	if err := b.SetStreamHandler(testProtocol, echoHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "protocols added event", func() bool {
+		e := events.find(PeerEventProtocolsAdded, bID)
+		return e != nil && e.Protocols.Count() == 1 && e.Protocols.Get(0) == testProtocol
+	})
+
+	// 节点下线时为仍然连接的节点补发断开事件
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "disconnected event", func() bool { return events.has(PeerEventDisconnected, bID) })
+}
+
+func TestPeerEventListenerRemove(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+
+	events := &testPeerEvents{}
+	if err := a.SetPeerEventListener(events); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetPeerEventListener(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestNodes(t, a, b)
+	time.Sleep(500 * time.Millisecond)
+	if n := events.count(); n != 0 {
+		t.Fatalf("removed listener received %d events", n)
+	}
+}
+
+func TestPeerEventsUnexpected(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if pes := peerEvents(zap.NewNop(), n.mobile().PeerHost(), "unexpected"); pes != nil {
+		t.Fatalf("unexpected event converted to %v", pes)
+	}
+	if d := directionName(network.DirUnknown); d != "unknown" {
+		t.Fatalf("directionName = %q", d)
+	}
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ipfs_config "github.com/ipfs/kubo/config"
+)
+
+// mobileProfile是移动平台专用的配置profile
+type mobileProfile struct {
+	description string
+	patch       RepoConfigPatch
+}
+
+// mobileProfiles是在kubo内置profile(如"lowpower"、"test")之外提供的移动平台profile
+var mobileProfiles = map[string]mobileProfile{
+	"mobile-cellular": {
+		description: "Reduces data usage on metered networks: few connections, no reproviding, no relay service and no mDNS.",
+		patch: func(cfg *ipfs_config.Config) error {
+			cfg.Routing.Type = ipfs_config.NewOptionalString("dhtclient")
+			cfg.AutoNAT.ServiceMode = ipfs_config.AutoNATServiceDisabled
+			cfg.Swarm.RelayService.Enabled = ipfs_config.False
+			cfg.Swarm.ConnMgr.Type = ipfs_config.NewOptionalString("basic")
+			cfg.Swarm.ConnMgr.LowWater = ipfs_config.NewOptionalInteger(10)
+			cfg.Swarm.ConnMgr.HighWater = ipfs_config.NewOptionalInteger(30)
+			cfg.Swarm.ConnMgr.GracePeriod = ipfs_config.NewOptionalDuration(time.Minute)
+			cfg.Reprovider.Interval = ipfs_config.NewOptionalDuration(0)
+			cfg.Discovery.MDNS.Enabled = false
+			return nil
+		},
+	},
+	"local-discovery-only": {
+		description: "Only talks to peers on the local network or nearby (mDNS, BLE): no bootstrap peers, no DHT, no reproviding.",
+		patch: func(cfg *ipfs_config.Config) error {
+			cfg.Bootstrap = []string{}
+			cfg.Routing.Type = ipfs_config.NewOptionalString("none")
+			cfg.AutoNAT.ServiceMode = ipfs_config.AutoNATServiceDisabled
+			cfg.Swarm.RelayClient.Enabled = ipfs_config.False
+			cfg.Swarm.RelayService.Enabled = ipfs_config.False
+			cfg.Swarm.DisableNatPortMap = true
+			cfg.AutoTLS.Enabled = ipfs_config.False
+			cfg.Reprovider.Interval = ipfs_config.NewOptionalDuration(0)
+			cfg.Discovery.MDNS.Enabled = true
+			return nil
+		},
+	},
+}
+
+// lookupProfile查找移动平台profile或kubo内置profile
+func lookupProfile(name string) (RepoConfigPatch, bool, error) {
+	if p, ok := mobileProfiles[name]; ok {
+		return p.patch, false, nil
+	}
+
+	if p, ok := ipfs_config.Profiles[name]; ok {
+		return RepoConfigPatch(p.Transform), p.InitOnly, nil
+	}
+
+	return nil, false, fmt.Errorf("%s is not a profile", name)
+}
+
+// ListProfiles返回所有可用的profile名称，包括kubo内置的profile
+func ListProfiles() *StringList {
+	names := make([]string, 0, len(mobileProfiles)+len(ipfs_config.Profiles))
+	for name := range mobileProfiles {
+		names = append(names, name)
+	}
+	for name := range ipfs_config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return newStringList(names)
+}
+
+// ProfileDescription返回profile的说明
+func ProfileDescription(name string) (string, error) {
+	if p, ok := mobileProfiles[name]; ok {
+		return p.description, nil
+	}
+
+	if p, ok := ipfs_config.Profiles[name]; ok {
+		return strings.TrimSpace(p.Description), nil
+	}
+
+	return "", fmt.Errorf("%s is not a profile", name)
+}
+
+// NewConfigWithProfiles创建默认配置并依次应用给定的profile
+// profiles与`ipfs init --profile`相同，以逗号分隔，例如"lowpower,mobile-cellular"
+func NewConfigWithProfiles(profiles string) (*Config, error) {
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	patchs := []RepoConfigPatch{}
+	for _, name := range strings.Split(profiles, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		patch, _, err := lookupProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		patchs = append(patchs, patch)
+	}
+
+	if err := ChainIpfsConfigPatch(patchs...)(cfg.cfg); err != nil {
+		return nil, fmt.Errorf("unable to apply profiles: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// ApplyProfile对配置应用profile
+func (c *Config) ApplyProfile(name string) error {
+	patch, _, err := lookupProfile(name)
+	if err != nil {
+		return err
+	}
+
+	return patch(c.cfg)
+}
+
+// ApplyProfile对仓库配置应用profile并写入仓库
+// 应用前的配置会备份到仓库目录，可以通过RevertProfile恢复，内存仓库不会备份
+// 只能在初始化时使用的profile(如数据存储类型)会返回错误
+func (r *Repo) ApplyProfile(name string) error {
+	patch, initOnly, err := lookupProfile(name)
+	if err != nil {
+		return err
+	}
+
+	if initOnly {
+		return fmt.Errorf("profile %s can only be applied on init", name)
+	}
+
+	// 与`ipfs config profile apply`一样备份应用前的配置，内存仓库没有保存备份的位置
+	var backup []byte
+	if err := r.mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		if r.mr.Path() != "" {
+			b, err := ipfs_config.Marshal(cfg)
+			if err != nil {
+				return err
+			}
+			backup = b
+		}
+
+		return patch(cfg)
+	}); err != nil {
+		return err
+	}
+
+	// 配置写入成功后才保存备份，profile应用失败时不会留下备份
+	if backup != nil {
+		if err := os.WriteFile(r.profileBackupPath(name), backup, 0o600); err != nil {
+			return fmt.Errorf("profile %s applied but unable to backup config: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// RevertProfile将仓库配置恢复为应用profile之前的状态
+// 应用profile之后对配置的其他修改也会被撤销，但保留当前的身份(例如RotateIdentity之后的新身份)
+func (r *Repo) RevertProfile(name string) error {
+	if _, _, err := lookupProfile(name); err != nil {
+		return err
+	}
+
+	if r.mr.Path() == "" {
+		return fmt.Errorf("memory repo keeps no config backup")
+	}
+
+	backup := r.profileBackupPath(name)
+	b, err := os.ReadFile(backup)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("profile %s has not been applied", name)
+	} else if err != nil {
+		return fmt.Errorf("unable to read config backup: %w", err)
+	}
+
+	var oldCfg ipfs_config.Config
+	if err := json.Unmarshal(b, &oldCfg); err != nil {
+		return fmt.Errorf("invalid config backup: %w", err)
+	}
+
+	if err := r.mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		// 恢复备份中的旧身份会使节点ID与密钥库中保存的私钥不一致
+		identity := cfg.Identity
+		*cfg = oldCfg
+		cfg.Identity = identity
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return os.Remove(backup)
+}
+
+// profileBackupPath返回应用profile前配置的备份路径，命名与kubo的备份一致
+func (r *Repo) profileBackupPath(name string) string {
+	return filepath.Join(r.mr.Path(), "config-pre-"+name)
+}
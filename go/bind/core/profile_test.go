@@ -0,0 +1,205 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	ipfs_config "github.com/ipfs/kubo/config"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func openTestRepo(t *testing.T) *Repo {
+	t.Helper()
+
+	r, err := OpenRepo(newTestRepoPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	return r
+}
+
+func testConfigKey(t *testing.T, r *Repo, key string) string {
+	t.Helper()
+
+	b, err := r.GetConfigKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestApplyAndRevertProfile(t *testing.T) {
+	r := openTestRepo(t)
+	before := testConfigKey(t, r, "Routing.Type")
+
+	if err := r.ApplyProfile("mobile-cellular"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testConfigKey(t, r, "Routing.Type"); got != `"dhtclient"` {
+		t.Fatalf("profile not applied, Routing.Type is %s", got)
+	}
+	if _, err := os.Stat(r.profileBackupPath("mobile-cellular")); err != nil {
+		t.Fatalf("missing config backup: %v", err)
+	}
+
+	if err := r.RevertProfile("mobile-cellular"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testConfigKey(t, r, "Routing.Type"); got != before {
+		t.Fatalf("profile not reverted, Routing.Type is %s", got)
+	}
+	if _, err := os.Stat(r.profileBackupPath("mobile-cellular")); !os.IsNotExist(err) {
+		t.Fatalf("config backup was not removed: %v", err)
+	}
+
+	if err := r.RevertProfile("mobile-cellular"); err == nil {
+		t.Fatal("reverting a profile that is not applied should fail")
+	}
+}
+
+func TestRevertProfileKeepsIdentity(t *testing.T) {
+	r := openTestRepo(t)
+
+	if err := r.ApplyProfile("lowpower"); err != nil {
+		t.Fatal(err)
+	}
+
+	oldID := testConfigKey(t, r, "Identity.PeerID")
+	if _, err := r.RotateIdentity(""); err != nil {
+		t.Fatal(err)
+	}
+	newID := testConfigKey(t, r, "Identity.PeerID")
+	if newID == oldID {
+		t.Fatal("identity was not rotated")
+	}
+
+	if err := r.RevertProfile("lowpower"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testConfigKey(t, r, "Identity.PeerID"); got != newID {
+		t.Fatalf("revert restored peer id %s, expected %s", got, newID)
+	}
+
+	cfg, err := r.mr.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := cfg.Identity.DecodePrivateKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.String() != cfg.Identity.PeerID {
+		t.Fatal("private key does not match peer id after revert")
+	}
+}
+
+func TestApplyProfileErrors(t *testing.T) {
+	r := openTestRepo(t)
+
+	if err := r.ApplyProfile("no-such-profile"); err == nil {
+		t.Fatal("applying an unknown profile should fail")
+	}
+
+	if err := r.ApplyProfile("default-datastore"); err == nil {
+		t.Fatal("applying an init only profile should fail")
+	}
+
+	// profile应用失败时不会留下备份
+	mobileProfiles["test-failing"] = mobileProfile{
+		patch: func(cfg *ipfs_config.Config) error {
+			cfg.Routing.Type = ipfs_config.NewOptionalString("none")
+			return errors.New("failing profile")
+		},
+	}
+	defer delete(mobileProfiles, "test-failing")
+
+	before := testConfigKey(t, r, "Routing.Type")
+	if err := r.ApplyProfile("test-failing"); err == nil {
+		t.Fatal("a failing profile should return an error")
+	}
+	if got := testConfigKey(t, r, "Routing.Type"); got != before {
+		t.Fatalf("failing profile changed config: %s", got)
+	}
+	if _, err := os.Stat(r.profileBackupPath("test-failing")); !os.IsNotExist(err) {
+		t.Fatalf("failing profile left a backup: %v", err)
+	}
+}
+
+func TestRevertProfileMemoryRepo(t *testing.T) {
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewMemoryRepo(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.ApplyProfile("mobile-cellular"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RevertProfile("mobile-cellular"); err == nil {
+		t.Fatal("memory repo keeps no backup, revert should fail")
+	}
+}
+
+func TestMobileProfileRouting(t *testing.T) {
+	for _, c := range []struct {
+		profile string
+		dht     bool
+		mode    dht.ModeOpt
+	}{
+		{"mobile-cellular", true, dht.ModeClient},
+		{"local-discovery-only", false, 0},
+	} {
+		path := t.TempDir()
+		if err := InitRepo(path, newTestConfig(t)); err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenRepo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.ApplyProfile(c.profile); err != nil {
+			r.Close()
+			t.Fatal(err)
+		}
+		// 测试不使用mDNS
+		if err := r.SetConfigKey("Discovery.MDNS.Enabled", []byte("false")); err != nil {
+			r.Close()
+			t.Fatal(err)
+		}
+
+		n, err := NewNode(r, nil)
+		if err != nil {
+			r.Close()
+			t.Fatal(err)
+		}
+
+		d := n.mobile().DHT
+		switch {
+		case !c.dht && d != nil:
+			t.Errorf("%s: DHT was built", c.profile)
+		case c.dht && d == nil:
+			t.Errorf("%s: no DHT", c.profile)
+		case c.dht && d.WAN.Mode() != c.mode:
+			t.Errorf("%s: DHT mode = %v, want %v", c.profile, d.WAN.Mode(), c.mode)
+		}
+
+		if err := n.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
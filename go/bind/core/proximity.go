@@ -11,3 +11,16 @@ type ProximityDriver interface {
 type ProximityTransport interface {
 	proximity.ProximityTransport
 }
+
+// GetProximityTransport返回指定协议名称当前正在监听的邻近传输
+// 原生驱动通过它回调HandleFoundPeer/ReceiveFromPeer等方法，未找到时返回nil
+func GetProximityTransport(protocolName string) ProximityTransport {
+	proximity.TransportMapMutex.RLock()
+	defer proximity.TransportMapMutex.RUnlock()
+
+	if t, ok := proximity.TransportMap[protocolName]; ok {
+		return t
+	}
+
+	return nil
+}
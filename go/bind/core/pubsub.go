@@ -0,0 +1,248 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"go.uber.org/zap"
+)
+
+// pubsubBufferSize是每个订阅等待交给原生处理器的最大消息数
+// 缓冲区满时丢弃新消息，避免处理缓慢的原生代码阻塞gossipsub
+const pubsubBufferSize = 128
+
+// PubSubHandler由原生平台实现，用于接收订阅主题的消息
+// 同一订阅的消息在专用的goroutine上按顺序回调
+type PubSubHandler interface {
+	HandleMessage(from string, seqno []byte, data []byte)
+}
+
+// Subscription是一个活动的PubSub订阅
+// 节点切换在线状态时订阅会在新的节点上自动恢复，离线期间收不到消息
+type Subscription struct {
+	topic   string
+	node    *Node
+	handler PubSubHandler
+	logger  *zap.Logger
+
+	msgs chan coreiface.PubSubMessage // 等待交给处理器的消息，在订阅的整个生命周期内使用
+	done chan struct{}                // Cancel时关闭
+	once sync.Once
+
+	mu     sync.Mutex
+	sub    coreiface.PubSubSubscription // 当前节点上的订阅，离线时为nil
+	cancel context.CancelFunc
+}
+
+// Topic返回订阅的主题
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// Cancel取消订阅，可以重复调用，也可以在消息回调中调用
+func (s *Subscription) Cancel() (err error) {
+	s.once.Do(func() {
+		close(s.done)
+
+		n := s.node
+		n.muPubSub.Lock()
+		delete(n.subscriptions, s)
+		n.muPubSub.Unlock()
+
+		err = s.detach()
+	})
+
+	return
+}
+
+// attach在节点上订阅主题，收到的消息放入缓冲区，缓冲区满时丢弃
+func (s *Subscription) attach(im *IpfsMobile) error {
+	api, err := im.CoreAPI()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(s.node.ctx)
+	sub, err := api.PubSub().Subscribe(ctx, s.topic, options.PubSub.Discover(true))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("unable to subscribe to `%s`: %w", s.topic, err)
+	}
+
+	s.mu.Lock()
+	s.sub = sub
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Warn("subscription ended", zap.Error(err))
+				}
+				return
+			}
+
+			select {
+			case s.msgs <- msg:
+			default:
+				s.logger.Warn("handler is too slow, dropping message")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// detach取消节点上的订阅，订阅本身保持有效
+func (s *Subscription) detach() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sub == nil {
+		return nil
+	}
+
+	s.cancel()
+	err := s.sub.Close()
+	s.sub = nil
+	s.cancel = nil
+
+	return err
+}
+
+// PubSubPublish向主题发布消息
+func (n *Node) PubSubPublish(topic string, data []byte) error {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return err
+	}
+
+	// gomobile传入的切片在调用返回后可能失效，这里复制一份
+	b := make([]byte, len(data))
+	copy(b, data)
+
+	return api.PubSub().Publish(n.ctx, topic, b)
+}
+
+// PubSubSubscribe订阅主题，收到的消息会交给handler处理
+// 离线时订阅的主题会在节点上线后开始接收消息
+func (n *Node) PubSubSubscribe(topic string, handler PubSubHandler) (*Subscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("handler cannot be nil")
+	}
+
+	if n.ctx.Err() != nil {
+		return nil, fmt.Errorf("node is closed")
+	}
+
+	s := &Subscription{
+		topic:   topic,
+		node:    n,
+		handler: handler,
+		logger:  n.logger.Named("pubsub").With(zap.String("topic", topic)),
+		msgs:    make(chan coreiface.PubSubMessage, pubsubBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	n.muPubSub.Lock()
+	if n.pubsubMobile != nil {
+		if err := s.attach(n.pubsubMobile); err != nil {
+			n.muPubSub.Unlock()
+			return nil, err
+		}
+	}
+	n.subscriptions[s] = struct{}{}
+	n.muPubSub.Unlock()
+
+	// 在专用goroutine上回调原生处理器
+	go func() {
+		for {
+			select {
+			case msg := <-s.msgs:
+				select {
+				case <-s.done:
+					return
+				default:
+				}
+
+				handler.HandleMessage(msg.From().String(), msg.Seq(), msg.Data())
+			case <-s.done:
+				return
+			case <-n.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+// attachSubscriptions在上线的节点上恢复所有订阅，im为nil(离线)时只记录节点
+func (n *Node) attachSubscriptions(im *IpfsMobile) {
+	n.muPubSub.Lock()
+	defer n.muPubSub.Unlock()
+
+	n.pubsubMobile = im
+	if im == nil {
+		return
+	}
+
+	for s := range n.subscriptions {
+		if err := s.attach(im); err != nil {
+			s.logger.Error("unable to restore subscription", zap.Error(err))
+		}
+	}
+}
+
+// detachSubscriptions在节点关闭前取消所有节点上的订阅，订阅会在下次上线时恢复
+func (n *Node) detachSubscriptions() {
+	n.muPubSub.Lock()
+	defer n.muPubSub.Unlock()
+
+	n.pubsubMobile = nil
+	for s := range n.subscriptions {
+		if err := s.detach(); err != nil {
+			s.logger.Debug("unable to close subscription", zap.Error(err))
+		}
+	}
+}
+
+// PubSubPeers返回在给定主题上连接的节点，topic为空时返回所有PubSub节点
+func (n *Node) PubSubPeers(topic string) (*StringList, error) {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := api.PubSub().Peers(n.ctx, options.PubSub.Topic(topic))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(peers))
+	for i, p := range peers {
+		ids[i] = p.String()
+	}
+
+	return newStringList(ids), nil
+}
+
+// PubSubTopics返回当前已订阅的主题
+func (n *Node) PubSubTopics() (*StringList, error) {
+	api, err := n.mobile().CoreAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := api.PubSub().Ls(n.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStringList(topics), nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+type testPubSubHandler struct {
+	msgs chan string
+}
+
+func (h *testPubSubHandler) HandleMessage(from string, seqno []byte, data []byte) {
+	select {
+	case h.msgs <- string(data):
+	default:
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+	aID := a.mobile().PeerHost().ID().String()
+
+	handler := &testPubSubHandler{msgs: make(chan string, 16)}
+	sub, err := b.PubSubSubscribe("test-topic", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Topic() != "test-topic" {
+		t.Fatalf("Topic = %q", sub.Topic())
+	}
+
+	topics, err := b.PubSubTopics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topics.Count() != 1 || topics.Get(0) != "test-topic" {
+		t.Fatalf("unexpected topics: %v", topics.items)
+	}
+
+	if _, err := a.PubSubSubscribe("test-topic", &testPubSubHandler{msgs: make(chan string, 16)}); err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestNodes(t, a, b)
+	waitFor(t, "topic peer", func() bool {
+		peers, err := b.PubSubPeers("test-topic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return peers.Count() == 1 && peers.Get(0) == aID
+	})
+
+	waitFor(t, "message", func() bool {
+		if err := a.PubSubPublish("test-topic", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case msg := <-handler.msgs:
+			return msg == "hello"
+		default:
+			return false
+		}
+	})
+
+	// 取消后不再回调处理器，重复取消不报错
+	if err := sub.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	for len(handler.msgs) > 0 {
+		<-handler.msgs
+	}
+
+	if err := a.PubSubPublish("test-topic", []byte("after cancel")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-handler.msgs:
+		t.Fatalf("received %q after Cancel", msg)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestPubSubErrors(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if _, err := n.PubSubSubscribe("test-topic", nil); err == nil {
+		t.Fatal("subscribing without a handler should fail")
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.PubSubSubscribe("test-topic", &testPubSubHandler{}); err == nil {
+		t.Fatal("subscribing on a closed node should fail")
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"io"
+)
+
+// Reader由原生平台实现，用于以流的方式向节点提供数据(例如请求体)
+type Reader interface {
+	// Read返回最多n个字节的数据，返回空数据表示已读完
+	Read(n int) ([]byte, error)
+}
+
+// nativeReader将原生Reader适配为io.Reader
+type nativeReader struct {
+	r   Reader
+	buf []byte // 原生端多返回的数据，留到下次读取
+	eof bool
+}
+
+func newNativeReader(r Reader) io.Reader {
+	return &nativeReader{r: r}
+}
+
+func (nr *nativeReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if len(nr.buf) == 0 {
+		if nr.eof {
+			return 0, io.EOF
+		}
+
+		b, err := nr.r.Read(len(p))
+		if err != nil {
+			return 0, err
+		}
+
+		if len(b) == 0 {
+			nr.eof = true
+			return 0, io.EOF
+		}
+
+		nr.buf = b
+	}
+
+	n := copy(p, nr.buf)
+	nr.buf = nr.buf[n:]
+	return n, nil
+}
+
+// ReadCloser是暴露给原生平台的流式读取对象
+// 原生端按块读取数据，内存占用与块大小相关而与数据总量无关
+type ReadCloser struct {
+	rc     io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func newReadCloser(rc io.ReadCloser, cancel context.CancelFunc) *ReadCloser {
+	return &ReadCloser{
+		rc:     rc,
+		cancel: cancel,
+	}
+}
+
+// Read读取最多n个字节，返回空数据(nil)表示已读完
+func (r *ReadCloser) Read(n int) ([]byte, error) {
+	return readN(r.rc, n)
+}
+
+// Close关闭读取对象并取消仍在进行中的操作
+func (r *ReadCloser) Close() error {
+	err := r.rc.Close()
+	if r.cancel != nil {
+		r.cancel()
+	}
+
+	return err
+}
+
+// readN从r读取最多n个字节，返回nil表示已读完
+// 用于向原生平台暴露按块读取的接口
+func readN(r io.Reader, n int) ([]byte, error) {
+	if n <= 0 {
+		return []byte{}, nil
+	}
+
+	b := make([]byte, n)
+	for {
+		read, err := r.Read(b)
+		if read > 0 {
+			return b[:read], nil
+		}
+
+		switch err {
+		case nil:
+			// 没有读到数据也没有错误，继续读取
+		case io.EOF:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+}
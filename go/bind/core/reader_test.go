@@ -0,0 +1,143 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testReader是原生平台Reader的测试实现，每次最多返回chunk个字节
+type testReader struct {
+	r     *bytes.Reader
+	chunk int
+	err   error
+}
+
+func (r *testReader) Read(n int) ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if n > r.chunk {
+		n = r.chunk
+	}
+
+	b := make([]byte, n)
+	read, err := r.r.Read(b)
+	if err == io.EOF {
+		return []byte{}, nil
+	}
+	return b[:read], err
+}
+
+func TestNativeReader(t *testing.T) {
+	data := randomBytes(t, 10000)
+
+	b, err := io.ReadAll(newNativeReader(&testReader{r: bytes.NewReader(data), chunk: 333}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("data mismatch")
+	}
+
+	failure := errors.New("native failure")
+	if _, err := io.ReadAll(newNativeReader(&testReader{err: failure})); !errors.Is(err, failure) {
+		t.Fatalf("native error not returned: %v", err)
+	}
+}
+
+func TestReadN(t *testing.T) {
+	r := bytes.NewReader([]byte("abcdef"))
+
+	b, err := readN(r, 4)
+	if err != nil || string(b) != "abcd" {
+		t.Fatalf("readN = %q, %v", b, err)
+	}
+	b, err = readN(r, 4)
+	if err != nil || string(b) != "ef" {
+		t.Fatalf("readN = %q, %v", b, err)
+	}
+	b, err = readN(r, 4)
+	if err != nil || b != nil {
+		t.Fatalf("readN at EOF = %q, %v", b, err)
+	}
+	if b, err = readN(r, 0); err != nil || len(b) != 0 {
+		t.Fatalf("readN(0) = %q, %v", b, err)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	n := newTestNode(t, nil)
+	data := randomBytes(t, 3<<20)
+
+	// 请求体由原生Reader按块提供
+	body := &testReader{r: bytes.NewReader(data), chunk: 64 << 10}
+	out, err := n.NewRequest("add").Body(body).Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var added struct{ Hash string }
+	if err := json.Unmarshal(out, &added); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := n.NewRequest("cat").Argument(added.Hash).SendStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	for {
+		b, err := rc.Read(32 << 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b == nil {
+			break
+		}
+		if len(b) > 32<<10 {
+			t.Fatalf("read %d bytes, more than requested", len(b))
+		}
+		buf.Write(b)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("streamed content mismatch")
+	}
+}
+
+func TestSendStreamErrors(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if _, err := n.NewRequest("cat").Argument("not-a-cid").SendStream(); err == nil {
+		t.Fatal("invalid argument should fail before streaming")
+	}
+
+	res, err := n.AddBytes(randomBytes(t, 1<<20), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := n.NewRequest("cat").Argument(res.Cid).SendStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Read(1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// 提前关闭后不能继续读取
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Read(1024); err == nil {
+		t.Fatal("Read after Close should fail")
+	}
+
+	failure := errors.New("native failure")
+	if _, err := n.NewRequest("add").Body(&testReader{err: failure}).Send(); err == nil {
+		t.Fatal("add with a failing body should fail")
+	}
+}
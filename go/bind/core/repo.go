@@ -1,6 +1,8 @@
 package core
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"sync"
 
@@ -19,6 +21,9 @@ var (
 // Repo 结构体包装了移动平台的IPFS仓库
 type Repo struct {
 	mr *RepoMobile // 指向移动平台IPFS仓库的指针
+
+	muKeystore sync.Mutex
+	keystore   *nativeKeystore // 保存私钥的原生密钥库，未设置驱动时为nil
 }
 
 // RepoConfigPatch定义一个函数类型，用于修改IPFS配置
@@ -31,6 +36,13 @@ type RepoMobile struct {
 	// 嵌入标准IPFS仓库接口，继承其所有方法
 	ipfs_repo.Repo
 	path string
+
+	// 保证配置的读取-修改-写入依次进行
+	muConfig sync.Mutex
+
+	closeOnce sync.Once
+	closeErr  error
+	release   func() // 仓库关闭后取消进程内的登记，由OpenRepo设置
 }
 
 // 添加方法实现接口要求
@@ -38,6 +50,18 @@ func (r *RepoMobile) Path() string {
 	return r.path
 }
 
+// Close关闭底层仓库，多次调用只会关闭一次
+func (r *RepoMobile) Close() error {
+	r.closeOnce.Do(func() {
+		r.closeErr = r.Repo.Close()
+		if r.release != nil {
+			r.release()
+		}
+	})
+
+	return r.closeErr
+}
+
 // InitRepo 在指定路径初始化IPFS仓库
 func InitRepo(path string, cfg *Config) error {
 	// 加载插件，确保初始化仓库前插件系统已就绪
@@ -45,26 +69,58 @@ func InitRepo(path string, cfg *Config) error {
 		return err
 	}
 
+	// 确认选择的数据存储后端可用
+	if err := checkDatastorePlugins(cfg.getConfig().Datastore.Spec); err != nil {
+		return err
+	}
+
 	// 使用配置初始化仓库
 	return ipfs_fsrepo.Init(path, cfg.getConfig())
 }
 
 // OpenRepo 打开现有的IPFS仓库
+// 仓库版本过低或残留了锁文件时返回错误，需要自动处理时使用OpenRepoWithOptions
 func OpenRepo(path string) (*Repo, error) {
+	return openRepo(path, &RepoOptions{})
+}
+
+func openRepo(path string, opts *RepoOptions) (*Repo, error) {
 	// 加载插件，确保打开仓库前插件系统已就绪
 	if _, err := loadPlugins(path); err != nil {
 		return nil, err
 	}
 
+	// 同一个仓库在进程中只能打开一次
+	release, err := guardRepo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.recoverStaleLock {
+		if err := recoverStaleLock(path); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	if opts.migrate {
+		if err := migrateRepo(path, opts.listener); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
 	// 打开标准IPFS仓库
 	irepo, err := ipfs_fsrepo.Open(path)
 	if err != nil {
+		release()
 		return nil, err
 	}
 
 	// 创建移动平台适用的仓库包装
 	mRepo := NewRepoMobile(path, irepo)
-	return &Repo{mRepo}, nil
+	mRepo.release = release
+	return &Repo{mr: mRepo}, nil
 }
 
 // loadPlugins 加载IPFS插件系统
@@ -81,6 +137,17 @@ func loadPlugins(repoPath string) (*ipfs_loader.PluginLoader, error) {
 	// 构建插件目录路径
 	// 默认IPFS插件存放在仓库的"plugins"子目录
 	pluginpath := filepath.Join(repoPath, "plugins")
+	if repoPath == "" {
+		// 内存仓库没有插件目录，加载器总会扫描给定路径下的目录，
+		// 使用空的临时目录代替，避免加载当前工作目录中的插件
+		tmp, err := os.MkdirTemp("", "ipfs-plugins")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create empty plugin dir: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+
+		pluginpath = tmp
+	}
 
 	// 创建新的插件加载器
 	lp, err := ipfs_loader.NewPluginLoader(pluginpath)
@@ -131,12 +198,21 @@ func NewRepoMobile(path string, repo ipfs_repo.Repo) *RepoMobile {
 //
 //	可能的错误
 func (mr *RepoMobile) ApplyPatchs(patchs ...RepoConfigPatch) error {
+	mr.muConfig.Lock()
+	defer mr.muConfig.Unlock()
+
 	// 获取当前配置
 	cfg, err := mr.Config()
 	if err != nil {
 		return err
 	}
 
+	// 在副本上应用补丁，补丁失败时仓库中的配置保持不变
+	cfg, err = cfg.Clone()
+	if err != nil {
+		return err
+	}
+
 	// 使用链式补丁函数应用所有补丁
 	if err := ChainIpfsConfigPatch(patchs...)(cfg); err != nil {
 		return err
@@ -175,7 +251,92 @@ func ChainIpfsConfigPatch(patchs ...RepoConfigPatch) RepoConfigPatch {
 	}
 }
 
+// Close关闭仓库并释放仓库锁，仓库被节点使用时由Node.Close关闭
+func (r *Repo) Close() error {
+	return r.mr.Close()
+}
+
 // Mobile 返回底层的 RepoMobile 实例
 func (r *Repo) Mobile() *RepoMobile {
 	return r.mr
 }
+
+// GetConfigKey返回仓库配置项的JSON值，路径语义与`ipfs config`相同
+func (r *Repo) GetConfigKey(key string) ([]byte, error) {
+	cfg, err := r.mr.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return getConfigKey(cfg, key)
+}
+
+// SetConfigKey设置仓库配置项并写入仓库
+// 正在运行的节点大多不会应用新的配置，需要重新创建节点
+func (r *Repo) SetConfigKey(key string, jsonValue []byte) error {
+	return r.mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		newCfg, err := setConfigKey(cfg, key, jsonValue)
+		if err != nil {
+			return err
+		}
+
+		*cfg = *newCfg
+		return nil
+	})
+}
+
+// GetConfigJSON返回仓库配置的JSON，不包含私钥
+func (r *Repo) GetConfigJSON() ([]byte, error) {
+	cfg, err := r.mr.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return configToJSON(cfg)
+}
+
+// SetConfigJSON用JSON替换仓库配置并写入仓库，保留仓库的私钥
+func (r *Repo) SetConfigJSON(data []byte) error {
+	return r.mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		newCfg, err := configFromJSON(cfg, data)
+		if err != nil {
+			return err
+		}
+
+		*cfg = *newCfg
+		return nil
+	})
+}
+
+// GetConfig返回仓库配置的副本，修改副本不会影响仓库
+func (r *Repo) GetConfig() (*Config, error) {
+	cfg, err := r.mr.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := cfg.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{clone}, nil
+}
+
+// SetConfig将配置写入仓库，仓库的身份(节点ID和私钥)保持不变
+func (r *Repo) SetConfig(c *Config) error {
+	if c == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	newCfg, err := c.getConfig().Clone()
+	if err != nil {
+		return err
+	}
+
+	return r.mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		newCfg.Identity = cfg.Identity
+		*cfg = *newCfg
+		return nil
+	})
+}
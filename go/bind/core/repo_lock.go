@@ -0,0 +1,181 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	lockfile "github.com/ipfs/go-fs-lock"
+	ipfs_fsrepo "github.com/ipfs/kubo/repo/fsrepo"
+)
+
+var (
+	// openRepos记录当前进程中打开的仓库，防止同一个仓库被两个Repo同时打开
+	muOpenRepos sync.Mutex
+	openRepos   = map[string]struct{}{}
+)
+
+// RepoLockInfo描述仓库锁的状态
+type RepoLockInfo struct {
+	Locked   bool // 仓库锁被某个进程持有
+	OwnerPID int  // 持有锁的进程ID，无法确定时为0
+	Stale    bool // 锁文件残留但持有者已不存在，可以通过RepoOptions.SetRecoverStaleLock恢复
+}
+
+// SetRecoverStaleLock设置是否移除残留的仓库锁，默认不移除
+// 应用被系统杀死后可能残留锁文件，只有确定持有者已不存在时才会移除，锁被其他进程持有时仍然返回错误
+func (o *RepoOptions) SetRecoverStaleLock(recoverStaleLock bool) {
+	o.recoverStaleLock = recoverStaleLock
+}
+
+// RepoIsLocked返回仓库是否被某个进程(包括当前进程)打开
+func RepoIsLocked(path string) (bool, error) {
+	info, err := GetRepoLockInfo(path)
+	if err != nil {
+		return false, err
+	}
+
+	return info.Locked, nil
+}
+
+// GetRepoLockInfo返回仓库锁的状态
+// 锁由当前进程持有时OwnerPID为当前进程ID，平台支持时也会返回其他持有者的进程ID
+func GetRepoLockInfo(path string) (*RepoLockInfo, error) {
+	key, err := repoKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查锁文件时持有muOpenRepos，避免当前进程在检查期间打开仓库
+	muOpenRepos.Lock()
+	defer muOpenRepos.Unlock()
+
+	if _, ok := openRepos[key]; ok {
+		return &RepoLockInfo{Locked: true, OwnerPID: os.Getpid()}, nil
+	}
+
+	return lockFileInfo(path)
+}
+
+// lockFileInfo检查仓库的锁文件，调用方必须确认当前进程没有通过其他Repo持有这个仓库的锁
+// 不会在当前进程持有fcntl锁时打开锁文件：关闭任何指向锁文件的描述符都会释放当前进程在这个文件上的所有fcntl锁
+func lockFileInfo(path string) (*RepoLockInfo, error) {
+	lockPath := filepath.Join(path, ipfs_fsrepo.LockFile)
+	fi, err := os.Stat(lockPath)
+	if os.IsNotExist(err) {
+		return &RepoLockInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// 非空的锁文件是基于PID的锁(或者写了一半的文件)，fsrepo无法再加锁
+	if fi.Size() > 0 {
+		if pid := lockFilePID(lockPath); pid > 0 && pid != os.Getpid() && processAlive(pid) {
+			return &RepoLockInfo{Locked: true, OwnerPID: pid}, nil
+		}
+
+		if !staleLockSupported {
+			return &RepoLockInfo{Locked: true}, nil
+		}
+
+		return &RepoLockInfo{Stale: true}, nil
+	}
+
+	// 与fsrepo使用同一个go-fs-lock尝试加锁，当前进程已经持有锁时它在打开锁文件之前返回错误
+	lk, err := lockfile.Lock(path, ipfs_fsrepo.LockFile)
+	if err == nil {
+		// fcntl锁在进程退出时由系统释放，空的锁文件可以直接重新加锁，不影响打开仓库
+		lk.Close()
+		return &RepoLockInfo{}, nil
+	}
+
+	var lerr lockfile.LockedError
+	if !errors.As(err, &lerr) {
+		return nil, fmt.Errorf("unable to check repo lock: %w", err)
+	}
+
+	if strings.Contains(err.Error(), "held by us") {
+		return &RepoLockInfo{Locked: true, OwnerPID: os.Getpid()}, nil
+	}
+
+	return &RepoLockInfo{Locked: true, OwnerPID: lockOwnerPID(lockPath)}, nil
+}
+
+// recoverStaleLock在锁的持有者确定已不存在时移除残留的锁文件
+// 调用方必须已经通过guardRepo登记了仓库
+func recoverStaleLock(path string) error {
+	info, err := lockFileInfo(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.Stale {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(path, ipfs_fsrepo.LockFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove stale repo lock: %w", err)
+	}
+
+	return nil
+}
+
+// guardRepo在当前进程中登记打开的仓库，返回的函数在仓库关闭时取消登记
+func guardRepo(path string) (func(), error) {
+	key, err := repoKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	muOpenRepos.Lock()
+	defer muOpenRepos.Unlock()
+
+	if _, ok := openRepos[key]; ok {
+		return nil, fmt.Errorf("repo %s is already open in this process", path)
+	}
+	openRepos[key] = struct{}{}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			muOpenRepos.Lock()
+			delete(openRepos, key)
+			muOpenRepos.Unlock()
+		})
+	}, nil
+}
+
+// repoKey返回仓库的绝对路径，解析符号链接(如iOS上的/var和/private/var)
+func repoKey(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real, nil
+	}
+
+	return abs, nil
+}
+
+// lockFilePID返回基于PID的锁文件中记录的进程ID，格式与go4.org/lock相同，无法解析时返回0
+func lockFilePID(lockPath string) int {
+	b, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0
+	}
+
+	var meta struct {
+		OwnerPID int
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return 0
+	}
+
+	return meta.OwnerPID
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockOwnerPID从/proc/locks中按设备和inode查找持有锁文件上fcntl锁的进程，找不到时返回0
+// 不需要打开锁文件，不会影响当前进程持有的锁
+func lockOwnerPID(lockPath string) int {
+	fi, err := os.Stat(lockPath)
+	if err != nil {
+		return 0
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	dev := uint64(st.Dev)
+	id := fmt.Sprintf("%02x:%02x:%d", unix.Major(dev), unix.Minor(dev), st.Ino)
+
+	f, err := os.Open("/proc/locks")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	// 格式: "1: POSIX  ADVISORY  WRITE 1234 fd:01:5678 0 EOF"，OFD锁的进程ID为-1
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] != "POSIX" || fields[5] != id {
+			continue
+		}
+
+		if pid, err := strconv.Atoi(fields[4]); err == nil && pid > 0 {
+			return pid
+		}
+	}
+
+	return 0
+}
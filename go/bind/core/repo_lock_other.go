@@ -0,0 +1,8 @@
+//go:build !linux
+
+package core
+
+// lockOwnerPID无法在这个平台上不打开锁文件确认锁的持有者，返回0
+func lockOwnerPID(lockPath string) int {
+	return 0
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	lockfile "github.com/ipfs/go-fs-lock"
+	ipfs_fsrepo "github.com/ipfs/kubo/repo/fsrepo"
+)
+
+// lockHelperEnv指定子进程要加锁的仓库，lockHoldEnv不为空时子进程持有锁直到标准输入关闭
+const (
+	lockHelperEnv = "GOMOBILE_IPFS_LOCK_HELPER_REPO"
+	lockHoldEnv   = "GOMOBILE_IPFS_LOCK_HELPER_HOLD"
+)
+
+// TestLockHelperProcess在子进程中尝试加锁，仓库已被锁定时以3退出
+func TestLockHelperProcess(t *testing.T) {
+	path := os.Getenv(lockHelperEnv)
+	if path == "" {
+		t.Skip("helper process")
+	}
+
+	lk, err := lockfile.Lock(path, ipfs_fsrepo.LockFile)
+	if errors.As(err, new(lockfile.LockedError)) {
+		os.Exit(3)
+	} else if err != nil {
+		os.Exit(2)
+	}
+
+	if os.Getenv(lockHoldEnv) != "" {
+		os.Stdout.WriteString("locked\n")
+		_, _ = io.Copy(io.Discard, os.Stdin)
+	}
+
+	lk.Close()
+	os.Exit(0)
+}
+
+// lockedByOtherProcess返回另一个进程是否无法锁定仓库
+func lockedByOtherProcess(t *testing.T, path string) bool {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), lockHelperEnv+"="+path)
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 3:
+		return true
+	default:
+		t.Fatalf("lock helper process failed: %v", err)
+		return false
+	}
+}
+
+func TestGetRepoLockInfoKeepsLock(t *testing.T) {
+	path := newTestRepoPath(t)
+
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	info, err := GetRepoLockInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Locked || info.OwnerPID != os.Getpid() {
+		t.Fatalf("unexpected lock info: %+v", info)
+	}
+
+	if !lockedByOtherProcess(t, path) {
+		t.Fatal("repo lock was released by GetRepoLockInfo")
+	}
+
+	if _, err := OpenRepo(path); err == nil {
+		t.Fatal("opening the repo twice should fail")
+	}
+}
+
+func TestGetRepoLockInfoOutsideGuard(t *testing.T) {
+	path := newTestRepoPath(t)
+	if _, err := loadPlugins(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不经过OpenRepo打开仓库，锁只由fsrepo持有
+	repo, err := ipfs_fsrepo.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	for i := 0; i < 2; i++ {
+		info, err := GetRepoLockInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Locked || info.OwnerPID != os.Getpid() {
+			t.Fatalf("unexpected lock info: %+v", info)
+		}
+	}
+
+	if !lockedByOtherProcess(t, path) {
+		t.Fatal("repo lock was released by GetRepoLockInfo")
+	}
+}
+
+func TestRecoverStaleLock(t *testing.T) {
+	path := newTestRepoPath(t)
+
+	// 已经退出的进程留下的基于PID的锁文件
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(path, ipfs_fsrepo.LockFile)
+	if err := os.WriteFile(lockPath, []byte(`{"OwnerPID":`+strconv.Itoa(cmd.Process.Pid)+`}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := GetRepoLockInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Stale || info.Locked {
+		t.Fatalf("unexpected lock info: %+v", info)
+	}
+
+	if _, err := OpenRepo(path); err == nil {
+		t.Fatal("opening a repo with a stale lock should fail without recovery")
+	}
+
+	opts := NewRepoOptions()
+	opts.SetRecoverStaleLock(true)
+	r, err := OpenRepoWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if !lockedByOtherProcess(t, path) {
+		t.Fatal("recovered repo is not locked")
+	}
+}
+
+func TestGetRepoLockInfoOtherProcess(t *testing.T) {
+	path := newTestRepoPath(t)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), lockHelperEnv+"="+path, lockHoldEnv+"=1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		stdin.Close()
+		_ = cmd.Wait()
+	}()
+
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("lock helper process failed: %q %v", line, err)
+	}
+
+	info, err := GetRepoLockInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Locked || info.Stale {
+		t.Fatalf("unexpected lock info: %+v", info)
+	}
+	if runtime.GOOS == "linux" && info.OwnerPID != cmd.Process.Pid {
+		t.Fatalf("expected owner pid %d, got %d", cmd.Process.Pid, info.OwnerPID)
+	}
+
+	opts := NewRepoOptions()
+	opts.SetRecoverStaleLock(true)
+	if _, err := OpenRepoWithOptions(path, opts); err == nil {
+		t.Fatal("opening a repo locked by another process should fail")
+	}
+}
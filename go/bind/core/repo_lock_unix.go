@@ -0,0 +1,17 @@
+//go:build unix
+
+package core
+
+import (
+	"errors"
+	"syscall"
+)
+
+// staleLockSupported为true时可以证明锁的持有者已不存在
+const staleLockSupported = true
+
+// processAlive返回进程是否存在，没有权限向进程发送信号时也视为存在
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
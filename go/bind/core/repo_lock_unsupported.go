@@ -0,0 +1,11 @@
+//go:build !unix
+
+package core
+
+// staleLockSupported为false时无法证明锁的持有者已不存在，不会报告残留的锁
+const staleLockSupported = false
+
+// processAlive无法在这个平台上确认进程是否存在，视为存在
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/ipfs/boxo/filestore"
+	"github.com/ipfs/boxo/keystore"
+	ds "github.com/ipfs/go-datastore"
+	ds_query "github.com/ipfs/go-datastore/query"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	ipfs_config "github.com/ipfs/kubo/config"
+	ipfs_repo "github.com/ipfs/kubo/repo"
+	ipfs_common "github.com/ipfs/kubo/repo/common"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// NewMemoryRepo创建数据只保存在内存中的仓库，关闭后所有数据(包括身份)都会丢失
+// 用于无痕会话和测试，可以像OpenRepo返回的仓库一样创建节点
+// cfg为nil时使用NewDefaultConfig生成的配置，cfg中的数据存储配置会被忽略
+func NewMemoryRepo(cfg *Config) (*Repo, error) {
+	if cfg == nil {
+		var err error
+		if cfg, err = NewDefaultConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	clone, err := cfg.getConfig().Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	// 与InitRepo一样，确保创建节点前插件系统已就绪
+	if _, err := loadPlugins(""); err != nil {
+		return nil, err
+	}
+
+	mr := &memoryRepo{
+		cfg: clone,
+		ds:  ds_sync.MutexWrap(ds.NewMapDatastore()),
+		ks:  keystore.NewMemKeystore(),
+	}
+
+	return &Repo{mr: NewRepoMobile("", mr)}, nil
+}
+
+// memoryRepo是实现了ipfs_repo.Repo的内存仓库，路径为空
+type memoryRepo struct {
+	muConfig sync.Mutex
+	cfg      *ipfs_config.Config
+
+	ds ipfs_repo.Datastore
+	ks keystore.Keystore
+}
+
+var _ ipfs_repo.Repo = (*memoryRepo)(nil)
+
+func (r *memoryRepo) Config() (*ipfs_config.Config, error) {
+	r.muConfig.Lock()
+	defer r.muConfig.Unlock()
+
+	return r.cfg, nil
+}
+
+func (r *memoryRepo) Path() string {
+	return ""
+}
+
+func (r *memoryRepo) UserResourceOverrides() (rcmgr.PartialLimitConfig, error) {
+	return rcmgr.PartialLimitConfig{}, nil
+}
+
+func (r *memoryRepo) BackupConfig(prefix string) (string, error) {
+	return "", fmt.Errorf("memory repo cannot backup config")
+}
+
+func (r *memoryRepo) SetConfig(cfg *ipfs_config.Config) error {
+	clone, err := cfg.Clone()
+	if err != nil {
+		return err
+	}
+
+	r.muConfig.Lock()
+	r.cfg = clone
+	r.muConfig.Unlock()
+
+	return nil
+}
+
+func (r *memoryRepo) SetConfigKey(key string, value interface{}) error {
+	r.muConfig.Lock()
+	defer r.muConfig.Unlock()
+
+	m, err := ipfs_config.ToMap(r.cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := ipfs_common.MapSetKV(m, key, value); err != nil {
+		return err
+	}
+
+	cfg, err := ipfs_config.FromMap(m)
+	if err != nil {
+		return err
+	}
+
+	r.cfg = cfg
+	return nil
+}
+
+func (r *memoryRepo) GetConfigKey(key string) (interface{}, error) {
+	r.muConfig.Lock()
+	defer r.muConfig.Unlock()
+
+	m, err := ipfs_config.ToMap(r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return ipfs_common.MapGetKV(m, key)
+}
+
+func (r *memoryRepo) Datastore() ipfs_repo.Datastore {
+	return r.ds
+}
+
+// GetStorageUsage返回数据存储中所有值的大小
+func (r *memoryRepo) GetStorageUsage(ctx context.Context) (uint64, error) {
+	res, err := r.ds.Query(ctx, ds_query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	var size uint64
+	for e := range res.Next() {
+		if e.Error != nil {
+			return 0, e.Error
+		}
+		size += uint64(len(e.Value))
+	}
+
+	return size, nil
+}
+
+func (r *memoryRepo) Keystore() keystore.Keystore {
+	return r.ks
+}
+
+// FileManager返回nil，内存仓库不支持filestore
+func (r *memoryRepo) FileManager() *filestore.FileManager {
+	return nil
+}
+
+// SetAPIAddr不做任何事，内存仓库没有保存API地址的文件
+func (r *memoryRepo) SetAPIAddr(addr ma.Multiaddr) error {
+	return nil
+}
+
+// SetGatewayAddr不做任何事，内存仓库没有保存网关地址的文件
+func (r *memoryRepo) SetGatewayAddr(addr net.Addr) error {
+	return nil
+}
+
+// SwarmKey返回nil，内存仓库不支持私有网络
+func (r *memoryRepo) SwarmKey() ([]byte, error) {
+	return nil, nil
+}
+
+func (r *memoryRepo) Close() error {
+	return r.ds.Close()
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// memoryPluginsHelperEnv让测试进程在给定的工作目录中创建内存仓库，插件系统在进程中只加载一次
+const memoryPluginsHelperEnv = "GOMOBILE_IPFS_MEMORY_PLUGINS_HELPER"
+
+func TestMemoryPluginsHelperProcess(t *testing.T) {
+	dir := os.Getenv(memoryPluginsHelperEnv)
+	if dir == "" {
+		t.Skip("helper process")
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		os.Exit(2)
+	}
+
+	r, err := NewMemoryRepo(nil)
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+
+	r.Close()
+	os.Exit(0)
+}
+
+func TestNewMemoryRepoIgnoresWorkingDirPlugins(t *testing.T) {
+	// 当前工作目录中无法加载的插件不能影响内存仓库
+	dir := t.TempDir()
+	for _, p := range []string{"plugins", filepath.Join("plugins", "plugins")} {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, p, "bogus.so"), []byte("not a plugin"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMemoryPluginsHelperProcess$")
+	cmd.Env = append(os.Environ(), memoryPluginsHelperEnv+"="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("NewMemoryRepo loaded plugins from the working directory: %v\n%s", err, out)
+	}
+}
+
+func TestMemoryRepoNode(t *testing.T) {
+	r, err := NewMemoryRepo(newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.mr.Path() != "" {
+		t.Fatalf("memory repo has a path: %q", r.mr.Path())
+	}
+
+	n, err := NewNode(r, nil)
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	res, err := n.AddBytes([]byte("ephemeral"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := n.Cat(res.Cid, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ephemeral" {
+		t.Fatalf("Cat = %q", data)
+	}
+
+	stat, err := n.RepoStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.MountCount() != 1 || stat.GetMount(0).Type != "memory" {
+		t.Fatalf("unexpected memory repo mounts: %+v", stat.GetMount(0))
+	}
+}
+
+func TestMemoryRepoConfig(t *testing.T) {
+	r, err := NewMemoryRepo(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.SetConfigKey("Discovery.MDNS.Enabled", []byte("false")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.GetConfigKey("Discovery.MDNS.Enabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "false" {
+		t.Fatalf("Discovery.MDNS.Enabled = %s", v)
+	}
+
+	if _, err := r.mr.BackupConfig("test-"); err == nil {
+		t.Fatal("memory repo should not backup config")
+	}
+}
@@ -0,0 +1,356 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lockfile "github.com/ipfs/go-fs-lock"
+	ipfs_config "github.com/ipfs/kubo/config"
+	ipfs_fsrepo "github.com/ipfs/kubo/repo/fsrepo"
+	ipfs_migrations "github.com/ipfs/kubo/repo/fsrepo/migrations"
+)
+
+// 迁移进度的阶段
+const (
+	MigrationStageBackup   = "backup"   // 正在备份
+	MigrationStageMigrate  = "migrate"  // 正在执行一个版本的迁移
+	MigrationStageRollback = "rollback" // 迁移失败，正在恢复备份
+	MigrationStageDone     = "done"     // 全部迁移完成
+)
+
+// MigrationProgress描述仓库迁移的进度
+type MigrationProgress struct {
+	Stage       string // MigrationStageBackup等
+	FromVersion int    // 仓库迁移前的版本
+	ToVersion   int    // 迁移的目标版本
+	Step        int    // 当前是第几个版本的迁移，从1开始，备份时为0
+	Steps       int    // 需要迁移的版本数
+}
+
+// MigrationListener由原生平台实现，用于显示仓库迁移的进度
+type MigrationListener interface {
+	HandleMigrationProgress(p *MigrationProgress)
+}
+
+// RepoOptions保存OpenRepoWithOptions的选项
+type RepoOptions struct {
+	migrate          bool
+	listener         MigrationListener
+	recoverStaleLock bool
+}
+
+// NewRepoOptions创建默认选项，默认会自动迁移仓库
+func NewRepoOptions() *RepoOptions {
+	return &RepoOptions{
+		migrate: true,
+	}
+}
+
+// SetMigrate设置仓库版本过低时是否自动迁移，不迁移时与OpenRepo一样返回错误
+func (o *RepoOptions) SetMigrate(migrate bool) {
+	o.migrate = migrate
+}
+
+// SetMigrationListener设置迁移进度的监听器
+func (o *RepoOptions) SetMigrationListener(listener MigrationListener) {
+	o.listener = listener
+}
+
+// repoMigration把仓库从from版本迁移到from+1版本
+// 内置的迁移都只修改配置，cfg是配置文件的JSON对象，保留了kubo不认识的字段
+type repoMigration func(cfg map[string]interface{}) error
+
+// repoMigrations是进程内的迁移，按源版本索引，替代移动平台无法运行的fs-repo-migrations
+var repoMigrations = map[int]repoMigration{
+	12: migrateAddQuicV1,
+	13: migrateAcceleratedDHTClient,
+	14: migrateRemoveQuicDraft29,
+	15: migrateAddWebRTCDirect,
+}
+
+// OpenRepoWithOptions与OpenRepo相同，但仓库版本低于当前kubo的版本时会在进程内迁移仓库
+// 迁移前会备份配置和版本文件，任何一步失败都会恢复备份，仓库保持迁移前的状态
+func OpenRepoWithOptions(path string, opts *RepoOptions) (*Repo, error) {
+	if opts == nil {
+		opts = NewRepoOptions()
+	}
+
+	return openRepo(path, opts)
+}
+
+// migrateRepo把仓库迁移到当前kubo的版本，仓库已是当前版本时不做任何事
+func migrateRepo(path string, listener MigrationListener) error {
+	// 未初始化的仓库由fsrepo.Open返回错误
+	if !ipfs_fsrepo.IsInitialized(path) {
+		return nil
+	}
+
+	from, err := ipfs_migrations.RepoVersion(path)
+	if err != nil {
+		return fmt.Errorf("unable to read repo version: %w", err)
+	}
+
+	to := ipfs_fsrepo.RepoVersion
+	if from >= to {
+		// 版本过高时由fsrepo.Open返回错误
+		return nil
+	}
+
+	for v := from; v < to; v++ {
+		if _, ok := repoMigrations[v]; !ok {
+			return fmt.Errorf("no in-process migration from repo version %d to %d", v, v+1)
+		}
+	}
+
+	// 与fsrepo一样持有仓库锁，避免迁移时仓库被打开
+	lk, err := lockfile.Lock(path, ipfs_fsrepo.LockFile)
+	if err != nil {
+		return fmt.Errorf("unable to lock repo for migration: %w", err)
+	}
+	defer lk.Close()
+
+	progress := func(stage string, step int) {
+		if listener != nil {
+			listener.HandleMigrationProgress(&MigrationProgress{
+				Stage:       stage,
+				FromVersion: from,
+				ToVersion:   to,
+				Step:        step,
+				Steps:       to - from,
+			})
+		}
+	}
+
+	progress(MigrationStageBackup, 0)
+	backup, err := backupRepoConfig(path, from)
+	if err != nil {
+		return fmt.Errorf("unable to backup repo before migration: %w", err)
+	}
+
+	for v := from; v < to; v++ {
+		progress(MigrationStageMigrate, v-from+1)
+
+		if err := runRepoMigration(path, v); err != nil {
+			progress(MigrationStageRollback, v-from+1)
+			if rerr := restoreRepoConfig(path, backup); rerr != nil {
+				return fmt.Errorf("unable to migrate repo from version %d to %d: %w, unable to restore backup %s: %s", v, v+1, err, backup, rerr.Error())
+			}
+			return fmt.Errorf("unable to migrate repo from version %d to %d: %w", v, v+1, err)
+		}
+	}
+
+	progress(MigrationStageDone, to-from)
+	return nil
+}
+
+// runRepoMigration执行一个版本的迁移，先写入配置再写入版本
+func runRepoMigration(path string, from int) error {
+	configPath := filepath.Join(path, ipfs_config.DefaultConfigFile)
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := repoMigrations[from](cfg); err != nil {
+		return err
+	}
+
+	if b, err = ipfs_config.Marshal(cfg); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(configPath, b); err != nil {
+		return err
+	}
+
+	return ipfs_migrations.WriteRepoVersion(path, from+1)
+}
+
+// backupRepoConfig把配置和版本文件复制到仓库中的migration-backup-<版本>目录，返回备份目录
+// 备份在迁移成功后保留，可以手动恢复
+func backupRepoConfig(path string, version int) (string, error) {
+	backup := filepath.Join(path, fmt.Sprintf("migration-backup-%d", version))
+	if err := os.MkdirAll(backup, 0o700); err != nil {
+		return "", err
+	}
+
+	for _, name := range []string{ipfs_config.DefaultConfigFile, "version"} {
+		b, err := os.ReadFile(filepath.Join(path, name))
+		if err != nil {
+			return "", err
+		}
+
+		if err := writeFileAtomic(filepath.Join(backup, name), b); err != nil {
+			return "", err
+		}
+	}
+
+	return backup, nil
+}
+
+// restoreRepoConfig从备份目录恢复配置和版本文件
+func restoreRepoConfig(path string, backup string) error {
+	for _, name := range []string{ipfs_config.DefaultConfigFile, "version"} {
+		b, err := os.ReadFile(filepath.Join(backup, name))
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomic(filepath.Join(path, name), b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFileAtomic先写入临时文件再重命名，避免崩溃时留下写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// addressLists是Addresses中保存多地址列表的字段
+var addressLists = []string{"Swarm", "Announce", "AppendAnnounce", "NoAnnounce"}
+
+// migrateAddQuicV1(12到13，kubo 0.18)在每个/quic(draft-29)地址旁添加/quic-v1和/quic-v1/webtransport
+// 与kubo的迁移一样处理监听地址和所有公告地址列表，NoAnnounce中的地址在升级后仍然不会被公告
+func migrateAddQuicV1(cfg map[string]interface{}) error {
+	return mapAddrs(cfg, addressLists, func(addr string) []string {
+		if !strings.HasSuffix(addr, "/quic") {
+			return []string{addr}
+		}
+		return []string{addr, addr + "-v1", addr + "-v1/webtransport"}
+	})
+}
+
+// migrateAcceleratedDHTClient(13到14，kubo 0.21)把Experimental.AcceleratedDHTClient移到Routing.AcceleratedDHTClient
+func migrateAcceleratedDHTClient(cfg map[string]interface{}) error {
+	experimental, ok := cfg["Experimental"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	v, ok := experimental["AcceleratedDHTClient"]
+	if !ok {
+		return nil
+	}
+	delete(experimental, "AcceleratedDHTClient")
+
+	routing, ok := cfg["Routing"].(map[string]interface{})
+	if !ok {
+		routing = map[string]interface{}{}
+		cfg["Routing"] = routing
+	}
+
+	// 只有开启时才需要写入，未设置时默认关闭
+	if enabled, _ := v.(bool); enabled {
+		routing["AcceleratedDHTClient"] = true
+	}
+
+	return nil
+}
+
+// migrateRemoveQuicDraft29(14到15，kubo 0.23)移除所有/quic(draft-29)地址，只保留/quic-v1
+func migrateRemoveQuicDraft29(cfg map[string]interface{}) error {
+	isDraft29 := func(addr string) bool {
+		for _, c := range strings.Split(addr, "/") {
+			if c == "quic" {
+				return true
+			}
+		}
+		return false
+	}
+
+	addresses, ok := cfg["Addresses"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	for _, key := range addressLists {
+		addrs, ok := addresses[key].([]interface{})
+		if !ok {
+			continue
+		}
+
+		kept := []interface{}{}
+		for _, a := range addrs {
+			if s, ok := a.(string); ok && isDraft29(s) {
+				continue
+			}
+			kept = append(kept, a)
+		}
+		addresses[key] = kept
+	}
+
+	return nil
+}
+
+// migrateAddWebRTCDirect(15到16，kubo 0.30)在每个/udp/<端口>/quic-v1监听地址旁添加同一端口的/webrtc-direct
+func migrateAddWebRTCDirect(cfg map[string]interface{}) error {
+	return mapAddrs(cfg, []string{"Swarm"}, func(addr string) []string {
+		if !strings.HasSuffix(addr, "/quic-v1") {
+			return []string{addr}
+		}
+		return []string{addr, strings.TrimSuffix(addr, "/quic-v1") + "/webrtc-direct"}
+	})
+}
+
+// mapAddrs用fn的结果替换Addresses中keys列表的每个地址，已存在的地址不会重复添加
+func mapAddrs(cfg map[string]interface{}, keys []string, fn func(addr string) []string) error {
+	addresses, ok := cfg["Addresses"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	for _, key := range keys {
+		addrs, ok := addresses[key].([]interface{})
+		if !ok {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, a := range addrs {
+			if s, ok := a.(string); ok {
+				seen[s] = true
+			}
+		}
+
+		mapped := []interface{}{}
+		for _, a := range addrs {
+			s, ok := a.(string)
+			if !ok {
+				mapped = append(mapped, a)
+				continue
+			}
+
+			for i, m := range fn(s) {
+				if i > 0 && seen[m] {
+					continue
+				}
+				seen[m] = true
+				mapped = append(mapped, m)
+			}
+		}
+		addresses[key] = mapped
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ipfs_config "github.com/ipfs/kubo/config"
+	ipfs_fsrepo "github.com/ipfs/kubo/repo/fsrepo"
+	ipfs_migrations "github.com/ipfs/kubo/repo/fsrepo/migrations"
+)
+
+type testMigrationListener struct {
+	stages []string
+}
+
+func (l *testMigrationListener) HandleMigrationProgress(p *MigrationProgress) {
+	l.stages = append(l.stages, p.Stage)
+}
+
+func testAddresses(cfg map[string]interface{}, key string) []string {
+	addrs := []string{}
+	for _, a := range cfg["Addresses"].(map[string]interface{})[key].([]interface{}) {
+		addrs = append(addrs, a.(string))
+	}
+	return addrs
+}
+
+func TestMigrateAddQuicV1(t *testing.T) {
+	cfg := map[string]interface{}{
+		"Addresses": map[string]interface{}{
+			"Swarm":          []interface{}{"/ip4/0.0.0.0/tcp/4001", "/ip4/0.0.0.0/udp/4001/quic"},
+			"Announce":       []interface{}{"/ip4/1.2.3.4/udp/4001/quic"},
+			"AppendAnnounce": []interface{}{"/dns4/example.com/udp/4001/quic"},
+			"NoAnnounce":     []interface{}{"/ip4/10.0.0.1/udp/4001/quic", "/ip4/10.0.0.1/udp/4001/quic-v1"},
+		},
+	}
+
+	if err := migrateAddQuicV1(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"Swarm": {
+			"/ip4/0.0.0.0/tcp/4001",
+			"/ip4/0.0.0.0/udp/4001/quic", "/ip4/0.0.0.0/udp/4001/quic-v1", "/ip4/0.0.0.0/udp/4001/quic-v1/webtransport",
+		},
+		"Announce": {
+			"/ip4/1.2.3.4/udp/4001/quic", "/ip4/1.2.3.4/udp/4001/quic-v1", "/ip4/1.2.3.4/udp/4001/quic-v1/webtransport",
+		},
+		"AppendAnnounce": {
+			"/dns4/example.com/udp/4001/quic", "/dns4/example.com/udp/4001/quic-v1", "/dns4/example.com/udp/4001/quic-v1/webtransport",
+		},
+		// 已存在的地址不会重复添加
+		"NoAnnounce": {
+			"/ip4/10.0.0.1/udp/4001/quic", "/ip4/10.0.0.1/udp/4001/quic-v1/webtransport", "/ip4/10.0.0.1/udp/4001/quic-v1",
+		},
+	}
+	for key, addrs := range want {
+		if got := testAddresses(cfg, key); !reflect.DeepEqual(got, addrs) {
+			t.Errorf("Addresses.%s = %v, want %v", key, got, addrs)
+		}
+	}
+
+	// 没有Addresses的配置保持不变
+	if err := migrateAddQuicV1(map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateRemoveQuicDraft29(t *testing.T) {
+	cfg := map[string]interface{}{
+		"Addresses": map[string]interface{}{
+			"Swarm":      []interface{}{"/ip4/0.0.0.0/udp/4001/quic", "/ip4/0.0.0.0/udp/4001/quic-v1"},
+			"NoAnnounce": []interface{}{"/ip4/10.0.0.1/udp/4001/quic"},
+		},
+	}
+
+	if err := migrateRemoveQuicDraft29(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testAddresses(cfg, "Swarm"); !reflect.DeepEqual(got, []string{"/ip4/0.0.0.0/udp/4001/quic-v1"}) {
+		t.Errorf("Addresses.Swarm = %v", got)
+	}
+	if got := testAddresses(cfg, "NoAnnounce"); len(got) != 0 {
+		t.Errorf("Addresses.NoAnnounce = %v", got)
+	}
+}
+
+func TestMigrateAddWebRTCDirect(t *testing.T) {
+	cfg := map[string]interface{}{
+		"Addresses": map[string]interface{}{
+			"Swarm":    []interface{}{"/ip4/0.0.0.0/udp/4001/quic-v1"},
+			"Announce": []interface{}{"/ip4/1.2.3.4/udp/4001/quic-v1"},
+		},
+	}
+
+	if err := migrateAddWebRTCDirect(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testAddresses(cfg, "Swarm"); !reflect.DeepEqual(got, []string{"/ip4/0.0.0.0/udp/4001/quic-v1", "/ip4/0.0.0.0/udp/4001/webrtc-direct"}) {
+		t.Errorf("Addresses.Swarm = %v", got)
+	}
+	if got := testAddresses(cfg, "Announce"); !reflect.DeepEqual(got, []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}) {
+		t.Errorf("Addresses.Announce = %v", got)
+	}
+}
+
+func TestMigrateAcceleratedDHTClient(t *testing.T) {
+	cfg := map[string]interface{}{
+		"Experimental": map[string]interface{}{"AcceleratedDHTClient": true},
+	}
+
+	if err := migrateAcceleratedDHTClient(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cfg["Experimental"].(map[string]interface{})["AcceleratedDHTClient"]; ok {
+		t.Error("Experimental.AcceleratedDHTClient not removed")
+	}
+	if v := cfg["Routing"].(map[string]interface{})["AcceleratedDHTClient"]; v != true {
+		t.Errorf("Routing.AcceleratedDHTClient = %v", v)
+	}
+}
+
+// newOldTestRepo创建版本为version的仓库，配置中包含draft-29的QUIC地址
+func newOldTestRepo(t *testing.T, version int) string {
+	t.Helper()
+
+	path := newTestRepoPath(t)
+	configPath := filepath.Join(path, ipfs_config.DefaultConfigFile)
+
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	addresses := cfg["Addresses"].(map[string]interface{})
+	addresses["Swarm"] = []interface{}{"/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/udp/0/quic"}
+	addresses["Announce"] = []interface{}{"/ip4/1.2.3.4/udp/4001/quic"}
+	if b, err = json.Marshal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ipfs_migrations.WriteRepoVersion(path, version); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestOpenRepoWithOptionsMigrates(t *testing.T) {
+	path := newOldTestRepo(t, 12)
+
+	if _, err := OpenRepo(path); err == nil {
+		t.Fatal("OpenRepo should fail on an old repo")
+	}
+
+	opts := NewRepoOptions()
+	listener := &testMigrationListener{}
+	opts.SetMigrationListener(listener)
+
+	r, err := OpenRepoWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if v, err := ipfs_migrations.RepoVersion(path); err != nil || v != ipfs_fsrepo.RepoVersion {
+		t.Fatalf("repo version = %d (%v), want %d", v, err, ipfs_fsrepo.RepoVersion)
+	}
+	if listener.stages[0] != MigrationStageBackup || listener.stages[len(listener.stages)-1] != MigrationStageDone {
+		t.Fatalf("unexpected progress: %v", listener.stages)
+	}
+
+	cfg, err := r.mr.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSwarm := []string{"/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/udp/0/quic-v1", "/ip4/127.0.0.1/udp/0/webrtc-direct", "/ip4/127.0.0.1/udp/0/quic-v1/webtransport"}
+	if !reflect.DeepEqual(cfg.Addresses.Swarm, wantSwarm) {
+		t.Errorf("Addresses.Swarm = %v, want %v", cfg.Addresses.Swarm, wantSwarm)
+	}
+	wantAnnounce := []string{"/ip4/1.2.3.4/udp/4001/quic-v1", "/ip4/1.2.3.4/udp/4001/quic-v1/webtransport"}
+	if !reflect.DeepEqual(cfg.Addresses.Announce, wantAnnounce) {
+		t.Errorf("Addresses.Announce = %v, want %v", cfg.Addresses.Announce, wantAnnounce)
+	}
+}
+
+func TestOpenRepoWithOptionsErrors(t *testing.T) {
+	// 没有进程内迁移的版本
+	path := newOldTestRepo(t, 11)
+	if _, err := OpenRepoWithOptions(path, nil); err == nil {
+		t.Fatal("migrating from an unsupported version should fail")
+	}
+	if v, _ := ipfs_migrations.RepoVersion(path); v != 11 {
+		t.Fatalf("repo version changed to %d", v)
+	}
+
+	// 不允许迁移
+	path = newOldTestRepo(t, 12)
+	opts := NewRepoOptions()
+	opts.SetMigrate(false)
+	if _, err := OpenRepoWithOptions(path, opts); err == nil {
+		t.Fatal("opening an old repo without migration should fail")
+	}
+
+	// 迁移失败时恢复备份
+	configPath := filepath.Join(path, ipfs_config.DefaultConfigFile)
+	if err := os.WriteFile(configPath, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	listener := &testMigrationListener{}
+	opts = NewRepoOptions()
+	opts.SetMigrationListener(listener)
+	if _, err := OpenRepoWithOptions(path, opts); err == nil {
+		t.Fatal("migrating an invalid config should fail")
+	}
+	if v, _ := ipfs_migrations.RepoVersion(path); v != 12 {
+		t.Fatalf("repo version changed to %d", v)
+	}
+	if b, _ := os.ReadFile(configPath); string(b) != "{" {
+		t.Fatalf("config not restored: %q", b)
+	}
+	if listener.stages[len(listener.stages)-1] != MigrationStageRollback {
+		t.Fatalf("unexpected progress: %v", listener.stages)
+	}
+}
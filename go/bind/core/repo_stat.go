@@ -0,0 +1,400 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	ds "github.com/ipfs/go-datastore"
+	ipfs_config "github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/corerepo"
+)
+
+// defaultStorageGCWatermark是StorageGCWatermark未设置时使用的百分比，与kubo的默认配置相同
+const defaultStorageGCWatermark = 90
+
+// 存储配额的状态
+const (
+	StorageQuotaOK       = "ok"       // 仓库大小低于StorageMax的StorageGCWatermark
+	StorageQuotaWarning  = "warning"  // 仓库大小超过了StorageGCWatermark，应该运行垃圾回收或取消固定内容
+	StorageQuotaExceeded = "exceeded" // 仓库大小达到了StorageMax，写入新的块会失败(包括添加内容和通过bitswap获取内容)
+)
+
+// errStorageQuotaExceeded是添加内容会使仓库超过StorageMax时返回的错误
+var errStorageQuotaExceeded = errors.New("storage quota exceeded, run garbage collection or unpin some content")
+
+// RepoStat描述仓库的存储使用情况
+type RepoStat struct {
+	RepoSize   int64 // 数据存储占用的字节数
+	StorageMax int64 // Datastore.StorageMax，为0时不限制
+	NumObjects int64 // 块存储中的块数量
+
+	mounts []*MountStat
+}
+
+// MountStat描述数据存储中的一个挂载点
+type MountStat struct {
+	Mountpoint string // 挂载点，例如"/blocks"
+	Prefix     string // measure数据存储的指标前缀，例如"flatfs.datastore"，没有measure时为空
+	Type       string // 后端类型，例如"flatfs"、"levelds"，内存仓库为"memory"
+	Size       int64  // 后端在磁盘上占用的字节数
+}
+
+// MountCount返回挂载点数量
+func (s *RepoStat) MountCount() int {
+	return len(s.mounts)
+}
+
+// GetMount返回第i个挂载点，越界时返回nil
+func (s *RepoStat) GetMount(i int) *MountStat {
+	if i < 0 || i >= len(s.mounts) {
+		return nil
+	}
+
+	return s.mounts[i]
+}
+
+// StorageQuotaEvent是存储配额状态变化时交给原生平台的事件
+type StorageQuotaEvent struct {
+	State      string // 见StorageQuota*常量
+	RepoSize   int64  // 仓库当前的字节数
+	StorageMax int64  // Datastore.StorageMax
+}
+
+// StorageQuotaListener由原生平台实现，用于在添加内容开始失败之前提醒用户
+// 状态变化时回调一次，回调在触发检查的goroutine上进行
+type StorageQuotaListener interface {
+	HandleStorageQuota(e *StorageQuotaEvent)
+}
+
+// RepoStat返回仓库的大小、块数量和每个挂载点的大小
+// 需要遍历块存储和数据存储的目录，大仓库上可能需要较长时间，不要在主线程调用
+func (n *Node) RepoStat() (*RepoStat, error) {
+	mnode := n.mobile()
+
+	size, err := corerepo.RepoSize(n.ctx, mnode.IpfsNode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get repo size: %w", err)
+	}
+
+	keys, err := mnode.Blockstore.AllKeysChan(n.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list blocks: %w", err)
+	}
+
+	var count int64
+	for range keys {
+		count++
+	}
+
+	if err := n.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cfg, err := n.repo.mr.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	stat := &RepoStat{
+		RepoSize:   int64(size.RepoSize),
+		StorageMax: storageMaxBytes(size.StorageMax),
+		NumObjects: count,
+	}
+
+	path := n.repo.mr.Path()
+	if path == "" {
+		// 内存仓库忽略了数据存储配置，只有一个挂载点
+		stat.mounts = []*MountStat{{Mountpoint: "/", Type: "memory", Size: stat.RepoSize}}
+		return stat, nil
+	}
+
+	if stat.mounts, err = datastoreMounts(path, cfg.Datastore.Spec); err != nil {
+		return nil, fmt.Errorf("unable to get mount sizes: %w", err)
+	}
+
+	return stat, nil
+}
+
+// SetStorageQuotaListener设置存储配额监听器，替换之前设置的监听器，listener为nil时不再回调
+// 添加内容和垃圾回收后会检查配额，设置后会立即检查一次
+func (n *Node) SetStorageQuotaListener(listener StorageQuotaListener) error {
+	n.muQuota.Lock()
+	n.quotaListener = listener
+	n.quotaState = ""
+	n.muQuota.Unlock()
+
+	_, err := n.checkStorageQuota(n.ctx, 0)
+	return err
+}
+
+// checkStorageQuota计算再写入incoming个字节后的配额状态，状态变化时通知监听器
+func (n *Node) checkStorageQuota(ctx context.Context, incoming int64) (string, error) {
+	size, err := n.storage.quota.size(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to get repo size: %w", err)
+	}
+
+	cfg, err := n.repo.mr.Config()
+	if err != nil {
+		return "", err
+	}
+
+	state := storageQuotaState(size, cfg, incoming)
+
+	n.muQuota.Lock()
+	listener := n.quotaListener
+	changed := n.quotaState != state
+	n.quotaState = state
+	n.muQuota.Unlock()
+
+	// 在锁外回调，原生代码可以在回调中调用节点的方法
+	if changed && listener != nil {
+		listener.HandleStorageQuota(&StorageQuotaEvent{
+			State:      state,
+			RepoSize:   int64(size.RepoSize),
+			StorageMax: storageMaxBytes(size.StorageMax),
+		})
+	}
+
+	return state, nil
+}
+
+// reserveStorage在写入size个字节之前检查配额，写入后会超过StorageMax时返回错误
+// 这里只是提前拒绝明显放不下的内容，写入的每个块由storageQuota.checkPut检查
+func (n *Node) reserveStorage(size int64) error {
+	state, err := n.checkStorageQuota(n.ctx, size)
+	if err != nil {
+		return err
+	}
+
+	if state == StorageQuotaExceeded {
+		return errStorageQuotaExceeded
+	}
+
+	return nil
+}
+
+// storageQuota缓存仓库的使用量，检查配额时不需要每次统计数据存储的大小
+// 写入新的块时累加块的大小，垃圾回收后重新统计
+type storageQuota struct {
+	mr *RepoMobile // 节点使用的仓库，为nil时不检查配额
+
+	mu    sync.Mutex
+	usage uint64 // 仓库的字节数
+	valid bool   // usage是否已经统计
+}
+
+// size返回缓存的仓库大小和当前配置的StorageMax
+func (q *storageQuota) size(ctx context.Context) (corerepo.SizeStat, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.sizeLocked(ctx)
+}
+
+func (q *storageQuota) sizeLocked(ctx context.Context) (corerepo.SizeStat, error) {
+	cfg, err := q.mr.Config()
+	if err != nil {
+		return corerepo.SizeStat{}, err
+	}
+
+	storageMax := corerepo.NoLimit
+	if cfg.Datastore.StorageMax != "" {
+		if storageMax, err = humanize.ParseBytes(cfg.Datastore.StorageMax); err != nil {
+			return corerepo.SizeStat{}, err
+		}
+	}
+
+	if !q.valid {
+		if q.usage, err = q.mr.GetStorageUsage(ctx); err != nil {
+			return corerepo.SizeStat{}, err
+		}
+		q.valid = true
+	}
+
+	return corerepo.SizeStat{RepoSize: q.usage, StorageMax: storageMax}, nil
+}
+
+// invalidate使下次检查时重新统计仓库大小，垃圾回收后调用
+func (q *storageQuota) invalidate() {
+	q.mu.Lock()
+	q.valid = false
+	q.mu.Unlock()
+}
+
+// checkPut在写入新的块会使仓库超过StorageMax时返回错误，允许写入时累加块的大小
+// 只在接近上限时检查块是否已经存在，重复写入的块会使统计偏大，垃圾回收后会修正
+// 所有写入块的路径(AddBytes、NewRequest("add")、可写网关、bitswap)都会经过这里
+func (q *storageQuota) checkPut(ctx context.Context, d ds.Read, key ds.Key, size int) error {
+	if q.mr == nil || !isBlockKey(key) {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	st, err := q.sizeLocked(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get repo size: %w", err)
+	}
+
+	if st.StorageMax != corerepo.NoLimit && st.RepoSize+uint64(size) > st.StorageMax {
+		// 重新写入已有的块不占用新的空间
+		if has, err := d.Has(ctx, key); err == nil && has {
+			return nil
+		}
+
+		return errStorageQuotaExceeded
+	}
+
+	q.usage += uint64(size)
+	return nil
+}
+
+// storageQuotaState返回写入incoming个字节后的配额状态
+func storageQuotaState(size corerepo.SizeStat, cfg *ipfs_config.Config, incoming int64) string {
+	if size.StorageMax == corerepo.NoLimit {
+		return StorageQuotaOK
+	}
+
+	usage := size.RepoSize
+	if incoming > 0 {
+		usage += uint64(incoming)
+	}
+
+	watermark := cfg.Datastore.StorageGCWatermark
+	if watermark <= 0 || watermark > 100 {
+		watermark = defaultStorageGCWatermark
+	}
+
+	switch {
+	case usage >= size.StorageMax:
+		return StorageQuotaExceeded
+	case usage >= size.StorageMax/100*uint64(watermark):
+		return StorageQuotaWarning
+	default:
+		return StorageQuotaOK
+	}
+}
+
+// storageMaxBytes把kubo的NoLimit转换为0
+func storageMaxBytes(max uint64) int64 {
+	if max == corerepo.NoLimit {
+		return 0
+	}
+
+	return int64(max)
+}
+
+// SetStorageMax设置仓库的最大存储字节数(Datastore.StorageMax)，小于等于0时不限制
+// 配额检查立即使用新的值，kubo的自动垃圾回收在节点重新创建后才会使用
+func (r *Repo) SetStorageMax(maxBytes int64) error {
+	return r.mr.ApplyPatchs(func(cfg *ipfs_config.Config) error {
+		if maxBytes <= 0 {
+			cfg.Datastore.StorageMax = ""
+			return nil
+		}
+
+		cfg.Datastore.StorageMax = strconv.FormatInt(maxBytes, 10)
+		return nil
+	})
+}
+
+// datastoreMounts按照数据存储配置返回每个后端的挂载点和在磁盘上的大小
+func datastoreMounts(repoPath string, spec map[string]interface{}) ([]*MountStat, error) {
+	mounts := []*MountStat{}
+	if err := collectMounts(repoPath, spec, "/", "", &mounts); err != nil {
+		return nil, err
+	}
+
+	return mounts, nil
+}
+
+// collectMounts递归展开mount和measure，为每个后端计算大小
+func collectMounts(repoPath string, spec map[string]interface{}, mountpoint string, prefix string, out *[]*MountStat) error {
+	typ, _ := spec["type"].(string)
+
+	switch typ {
+	case "mount":
+		mounts, _ := spec["mounts"].([]interface{})
+		for _, m := range mounts {
+			child, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			mp, _ := child["mountpoint"].(string)
+			if err := collectMounts(repoPath, child, mp, prefix, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "measure":
+		p, _ := spec["prefix"].(string)
+		child, _ := spec["child"].(map[string]interface{})
+		return collectMounts(repoPath, child, mountpoint, p, out)
+	}
+
+	// log等其他包装类型同样通过child指向后端
+	if child, ok := spec["child"].(map[string]interface{}); ok {
+		return collectMounts(repoPath, child, mountpoint, prefix, out)
+	}
+
+	ms := &MountStat{
+		Mountpoint: mountpoint,
+		Prefix:     prefix,
+		Type:       typ,
+	}
+
+	if p, ok := spec["path"].(string); ok && p != "" {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(repoPath, p)
+		}
+
+		size, err := dirSize(p)
+		if err != nil {
+			return err
+		}
+		ms.Size = size
+	}
+
+	*out = append(*out, ms)
+	return nil
+}
+
+// dirSize返回目录中所有普通文件的大小之和，目录不存在时返回0
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 遍历期间被删除的文件(例如垃圾回收正在运行)不影响结果
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
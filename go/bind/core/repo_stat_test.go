@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testQuotaListener struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (l *testQuotaListener) HandleStorageQuota(e *StorageQuotaEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.states = append(l.states, e.State)
+}
+
+func (l *testQuotaListener) last() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.states) == 0 {
+		return ""
+	}
+	return l.states[len(l.states)-1]
+}
+
+// setTestStorageMax把StorageMax设置为当前仓库大小再加上free个字节
+func setTestStorageMax(t *testing.T, n *Node, free int64) {
+	t.Helper()
+
+	usage, err := n.repo.mr.GetStorageUsage(n.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.repo.SetStorageMax(int64(usage) + free); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepoStat(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if _, err := n.AddBytes(randomBytes(t, 4096), true); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := n.RepoStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.RepoSize <= 0 || stat.NumObjects <= 0 {
+		t.Fatalf("unexpected stat: %+v", stat)
+	}
+	if stat.StorageMax <= stat.RepoSize {
+		t.Fatalf("StorageMax = %d, want the default limit", stat.StorageMax)
+	}
+	if stat.MountCount() == 0 || stat.GetMount(0) == nil {
+		t.Fatal("no mounts")
+	}
+	if stat.GetMount(-1) != nil || stat.GetMount(stat.MountCount()) != nil {
+		t.Fatal("out of range mount should be nil")
+	}
+}
+
+func TestStorageQuotaExceeded(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	listener := &testQuotaListener{}
+	if err := n.SetStorageQuotaListener(listener); err != nil {
+		t.Fatal(err)
+	}
+	if got := listener.last(); got != StorageQuotaOK {
+		t.Fatalf("state = %q, want %q", got, StorageQuotaOK)
+	}
+
+	setTestStorageMax(t, n, 64<<10)
+
+	if _, err := n.AddBytes(randomBytes(t, 1024), true); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := n.AddBytes(randomBytes(t, 1<<20), true)
+	if !errors.Is(err, errStorageQuotaExceeded) {
+		t.Fatalf("AddBytes over the quota: %v", err)
+	}
+	if got := listener.last(); got != StorageQuotaExceeded {
+		t.Fatalf("state = %q, want %q", got, StorageQuotaExceeded)
+	}
+
+	// 命令接口不经过AddBytes的检查，由数据存储拒绝写入
+	_, err = n.NewRequest("add").BodyBytes(randomBytes(t, 1<<20)).Send()
+	if err == nil || !strings.Contains(err.Error(), errStorageQuotaExceeded.Error()) {
+		t.Fatalf("add command over the quota: %v", err)
+	}
+
+	// 已有的内容可以重新写入
+	data := randomBytes(t, 1024)
+	setTestStorageMax(t, n, 16<<10)
+	if _, err := n.AddBytes(data, true); err != nil {
+		t.Fatal(err)
+	}
+	setTestStorageMax(t, n, 0)
+	if _, err := n.NewRequest("add").BodyBytes(data).Send(); err != nil {
+		t.Fatalf("re-adding existing content: %v", err)
+	}
+
+	if err := n.repo.SetStorageMax(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.AddBytes(randomBytes(t, 1<<20), true); err != nil {
+		t.Fatalf("AddBytes without a quota: %v", err)
+	}
+}
+
+func TestStorageQuotaState(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	setTestStorageMax(t, n, 1<<20)
+	state, err := n.checkStorageQuota(n.ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != StorageQuotaOK {
+		t.Fatalf("state = %q, want %q", state, StorageQuotaOK)
+	}
+
+	if state, _ = n.checkStorageQuota(n.ctx, 1<<20-1); state != StorageQuotaWarning {
+		t.Fatalf("state = %q, want %q", state, StorageQuotaWarning)
+	}
+	if state, _ = n.checkStorageQuota(n.ctx, 2<<20); state != StorageQuotaExceeded {
+		t.Fatalf("state = %q, want %q", state, StorageQuotaExceeded)
+	}
+
+	if err := n.repo.SetConfigKey("Datastore.StorageMax", []byte(`"invalid"`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.checkStorageQuota(n.ctx, 0); err == nil {
+		t.Fatal("invalid StorageMax should fail")
+	}
+}
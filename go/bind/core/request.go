@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/boxo/files"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmds_http "github.com/ipfs/go-ipfs-cmds/http"
+)
+
+// RequestBuilder在进程内构建并执行kubo命令
+// 请求直接交给go-ipfs-cmds处理，语义与HTTP RPC API(/api/v0)完全一致，但不打开任何套接字
+type RequestBuilder struct {
+	node    *Node
+	command string
+	args    []string
+	opts    url.Values
+	body    io.Reader
+}
+
+// NewRequest为给定的命令路径创建请求，例如"id"、"pin/ls"、"dag/export"
+func (n *Node) NewRequest(command string) *RequestBuilder {
+	return &RequestBuilder{
+		node:    n,
+		command: strings.Trim(command, "/"),
+		opts:    url.Values{},
+	}
+}
+
+// Argument添加一个命令参数
+func (req *RequestBuilder) Argument(arg string) *RequestBuilder {
+	req.args = append(req.args, arg)
+	return req
+}
+
+// BoolOptions设置布尔类型的命令选项
+func (req *RequestBuilder) BoolOptions(key string, value bool) *RequestBuilder {
+	req.opts.Set(key, strconv.FormatBool(value))
+	return req
+}
+
+// StringOptions设置字符串类型的命令选项，数值类型的选项也以字符串传入
+func (req *RequestBuilder) StringOptions(key string, value string) *RequestBuilder {
+	req.opts.Set(key, value)
+	return req
+}
+
+// BodyBytes设置请求体，作为文件参数传给命令(例如add、block/put)
+func (req *RequestBuilder) BodyBytes(body []byte) *RequestBuilder {
+	// gomobile传入的切片在调用返回后可能失效，这里复制一份
+	b := make([]byte, len(body))
+	copy(b, body)
+	req.body = bytes.NewReader(b)
+	return req
+}
+
+// Body设置由原生平台流式提供的请求体，适用于无法一次性放入内存的大文件
+func (req *RequestBuilder) Body(body Reader) *RequestBuilder {
+	req.body = newNativeReader(body)
+	return req
+}
+
+// Send执行命令并返回完整的响应内容
+func (req *RequestBuilder) Send() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := req.send(context.Background(), &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// send执行命令并将响应内容写入out
+func (req *RequestBuilder) send(ctx context.Context, out io.Writer) error {
+	hreq, err := req.httpRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	rw := newResponseWriter(out)
+	req.node.mobile().cmdsHandler.ServeHTTP(rw, hreq)
+
+	return rw.err()
+}
+
+// SendStream执行命令并以流的方式返回响应内容
+// 命令本身的错误(如参数错误)会直接返回，输出过程中发生的错误会在读取时返回
+// 调用方读取完毕或放弃读取时必须调用ReadCloser.Close
+func (req *RequestBuilder) SendStream() (*ReadCloser, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hreq, err := req.httpRequest(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	rw := newResponseWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req.node.mobile().cmdsHandler.ServeHTTP(rw, hreq)
+		pw.CloseWithError(rw.err())
+	}()
+
+	// 等待响应头确定请求是否成功
+	select {
+	case <-rw.headerWritten:
+	case <-done:
+	}
+
+	if rw.failed() {
+		<-done
+		cancel()
+		return nil, rw.err()
+	}
+
+	return newReadCloser(pr, cancel), nil
+}
+
+// httpRequest将请求转换为命令处理器可以理解的HTTP请求
+func (req *RequestBuilder) httpRequest(ctx context.Context) (*http.Request, error) {
+	query := url.Values{}
+	for k, v := range req.opts {
+		query[k] = v
+	}
+	query["arg"] = req.args
+
+	u := url.URL{
+		Path:     "/" + req.command,
+		RawQuery: query.Encode(),
+	}
+
+	var (
+		body        io.Reader = http.NoBody
+		contentType string
+	)
+	if req.body != nil {
+		// 与HTTP客户端一致，以multipart/form-data形式传递文件参数
+		dir := files.NewMapDirectory(map[string]files.Node{
+			"": files.NewReaderFile(req.body),
+		})
+		mfr := files.NewMultiFileReader(dir, true, false)
+		body = mfr
+		contentType = "multipart/form-data; boundary=" + mfr.Boundary()
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	if contentType != "" {
+		hreq.Header.Set("Content-Type", contentType)
+	}
+
+	return hreq, nil
+}
+
+// responseWriter是进程内执行命令时使用的http.ResponseWriter
+// 正常响应写入w，出错时保存错误内容以便转换为Go错误
+type responseWriter struct {
+	header http.Header
+	status int
+	w      io.Writer
+	errBuf bytes.Buffer
+
+	// 写入响应头后关闭
+	headerWritten chan struct{}
+}
+
+func newResponseWriter(w io.Writer) *responseWriter {
+	return &responseWriter{
+		header:        http.Header{},
+		w:             w,
+		headerWritten: make(chan struct{}),
+	}
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+		close(rw.headerWritten)
+	}
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	if rw.failed() {
+		return rw.errBuf.Write(b)
+	}
+
+	return rw.w.Write(b)
+}
+
+// failed表示命令是否以错误状态结束
+func (rw *responseWriter) failed() bool {
+	return rw.status >= http.StatusBadRequest
+}
+
+// Flush实现http.Flusher，输出是直接写入的，无需额外处理
+func (rw *responseWriter) Flush() {}
+
+// err返回命令执行过程中产生的错误，包括流式输出中途发生的错误
+func (rw *responseWriter) err() error {
+	if rw.failed() {
+		var cmdErr cmds.Error
+		if err := json.Unmarshal(rw.errBuf.Bytes(), &cmdErr); err == nil && cmdErr.Message != "" {
+			return &cmdErr
+		}
+
+		if msg := strings.TrimSpace(rw.errBuf.String()); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+
+		return fmt.Errorf("request failed: %s", http.StatusText(rw.status))
+	}
+
+	if e := rw.header.Get(cmds_http.StreamErrHeader); e != "" {
+		return fmt.Errorf("%s", e)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewRequest(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	out, err := n.NewRequest("id").Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id struct{ ID string }
+	if err := json.Unmarshal(out, &id); err != nil {
+		t.Fatal(err)
+	}
+	if id.ID != n.mobile().Identity.String() {
+		t.Fatalf("id = %q, want %q", id.ID, n.mobile().Identity)
+	}
+
+	out, err = n.NewRequest("add").
+		BoolOptions("pin", true).
+		StringOptions("cid-version", "1").
+		BodyBytes([]byte("hello command")).
+		Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var added struct{ Hash string }
+	if err := json.Unmarshal(out, &added); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(added.Hash, "bafk") {
+		t.Fatalf("cid-version option ignored: %s", added.Hash)
+	}
+
+	out, err = n.NewRequest("/cat/").Argument(added.Hash).Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello command" {
+		t.Fatalf("cat = %q", out)
+	}
+
+	out, err = n.NewRequest("pin/ls").StringOptions("type", "recursive").Argument(added.Hash).Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), added.Hash) {
+		t.Fatalf("pin/ls = %s", out)
+	}
+}
+
+func TestNewRequestErrors(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if _, err := n.NewRequest("no/such/command").Send(); err == nil {
+		t.Fatal("unknown command should fail")
+	}
+
+	_, err := n.NewRequest("cat").Argument("not-a-cid").Send()
+	if err == nil {
+		t.Fatal("invalid argument should fail")
+	}
+
+	if _, err := n.NewRequest("pin/ls").StringOptions("type", "bogus").Send(); err == nil {
+		t.Fatal("invalid option should fail")
+	}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+
+	ds "github.com/ipfs/go-datastore"
+	ipfs_repo "github.com/ipfs/kubo/repo"
+)
+
+// blocksPrefix是块存储在数据存储中的前缀
+var blocksPrefix = ds.NewKey("/blocks")
+
+// storageGuard保存看门狗和存储配额对写入的限制，切换在线状态后新的节点继续使用同一个storageGuard
+type storageGuard struct {
+	rejectAdds   atomic.Bool
+	rejectBlocks atomic.Bool
+
+	quota storageQuota
+}
+
+// apply按照等级设置写入限制
+func (g *storageGuard) apply(level string) {
+	g.rejectAdds.Store(level == StorageLevelCritical || level == StorageLevelFull)
+	g.rejectBlocks.Store(level == StorageLevelFull)
+}
+
+// checkPut在拒绝写入块时对块存储中还不存在的键返回错误，然后检查存储配额
+// critical等级只拒绝应用发起的写入，full等级拒绝所有写入
+// 重新写入已有的块不占用新的空间，创建节点时会重新写入MFS根节点，不能拒绝
+func (g *storageGuard) checkPut(ctx context.Context, d ds.Read, key ds.Key, size int) error {
+	reject := g.rejectBlocks.Load() || (g.rejectAdds.Load() && isLocalWrite(ctx))
+	if reject && isBlockKey(key) {
+		if has, err := d.Has(ctx, key); err != nil || !has {
+			return errInsufficientStorage
+		}
+	}
+
+	return g.quota.checkPut(ctx, d, key, size)
+}
+
+// isBlockKey判断数据存储的键是否属于块存储
+func isBlockKey(key ds.Key) bool {
+	return key.Equal(blocksPrefix) || blocksPrefix.IsAncestorOf(key)
+}
+
+// guardedRepo使节点通过storageGuard写入数据存储
+type guardedRepo struct {
+	ipfs_repo.Repo
+	ds ipfs_repo.Datastore
+}
+
+// newGuardedRepo包装仓库，剩余空间不足或超过存储配额时拒绝写入新的块
+func newGuardedRepo(r ipfs_repo.Repo, guard *storageGuard) ipfs_repo.Repo {
+	return guardedRepo{
+		Repo: r,
+		ds:   &guardedDatastore{Batching: r.Datastore(), guard: guard},
+	}
+}
+
+func (r guardedRepo) Datastore() ipfs_repo.Datastore {
+	return r.ds
+}
+
+// guardedDatastore在storageGuard拒绝写入块时拒绝/blocks下的Put，删除和其他数据不受影响
+type guardedDatastore struct {
+	ds.Batching
+	guard *storageGuard
+}
+
+var (
+	_ ds.PersistentDatastore = (*guardedDatastore)(nil)
+	_ ds.GCDatastore         = (*guardedDatastore)(nil)
+	_ ds.CheckedDatastore    = (*guardedDatastore)(nil)
+	_ ds.ScrubbedDatastore   = (*guardedDatastore)(nil)
+)
+
+func (d *guardedDatastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	if err := d.guard.checkPut(ctx, d.Batching, key, len(value)); err != nil {
+		return err
+	}
+
+	return d.Batching.Put(ctx, key, value)
+}
+
+func (d *guardedDatastore) Batch(ctx context.Context) (ds.Batch, error) {
+	b, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &guardedBatch{Batch: b, ds: d.Batching, guard: d.guard}, nil
+}
+
+// DiskUsage转发给底层数据存储，保持GetStorageUsage等统计可用
+func (d *guardedDatastore) DiskUsage(ctx context.Context) (uint64, error) {
+	return ds.DiskUsage(ctx, d.Batching)
+}
+
+// CollectGarbage转发给底层数据存储，垃圾回收后由后端(如badger)回收空间
+func (d *guardedDatastore) CollectGarbage(ctx context.Context) error {
+	if gcds, ok := d.Batching.(ds.GCDatastore); ok {
+		return gcds.CollectGarbage(ctx)
+	}
+
+	return nil
+}
+
+// Check转发给底层数据存储
+func (d *guardedDatastore) Check(ctx context.Context) error {
+	if c, ok := d.Batching.(ds.CheckedDatastore); ok {
+		return c.Check(ctx)
+	}
+
+	return nil
+}
+
+// Scrub转发给底层数据存储
+func (d *guardedDatastore) Scrub(ctx context.Context) error {
+	if s, ok := d.Batching.(ds.ScrubbedDatastore); ok {
+		return s.Scrub(ctx)
+	}
+
+	return nil
+}
+
+type guardedBatch struct {
+	ds.Batch
+	ds    ds.Read
+	guard *storageGuard
+}
+
+func (b *guardedBatch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	if err := b.guard.checkPut(ctx, b.ds, key, len(value)); err != nil {
+		return err
+	}
+
+	return b.Batch.Put(ctx, key, value)
+}
@@ -0,0 +1,373 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	ipfs_core "github.com/ipfs/kubo/core"
+	ipfs_corehttp "github.com/ipfs/kubo/core/corehttp"
+	"go.uber.org/zap"
+)
+
+// 存储看门狗的默认值，适合16GB左右的设备
+const (
+	defaultWatchdogInterval     = time.Minute
+	defaultGCThreshold          = 1 << 30   // 剩余空间低于1GB时运行垃圾回收
+	defaultRejectAddsThreshold  = 512 << 20 // 剩余空间低于512MB时拒绝添加内容
+	defaultBlockWritesThreshold = 256 << 20 // 剩余空间低于256MB时不再保存通过bitswap收到的新块
+)
+
+// 剩余空间的等级，从好到坏排列
+const (
+	StorageLevelOK       = "ok"       // 剩余空间充足
+	StorageLevelLow      = "low"      // 低于GC阈值，已触发垃圾回收
+	StorageLevelCritical = "critical" // 低于拒绝添加阈值，应用发起的添加(AddBytes、AddFile、命令接口、可写网关)会失败
+	// StorageLevelFull低于块写入阈值，数据存储拒绝写入任何新的块:
+	// 添加内容、Pin远程内容、通过网关或bitswap获取还不在本地的内容都会失败，
+	// 已经保存的块仍然可以读取并提供给其他节点
+	StorageLevelFull = "full"
+)
+
+// 存储看门狗事件类型
+const (
+	StorageWatchdogEventLevel = "level" // 剩余空间的等级发生变化
+	StorageWatchdogEventGC    = "gc"    // 看门狗触发的垃圾回收已结束
+)
+
+// errInsufficientStorage是剩余空间不足时拒绝写入返回的错误
+var errInsufficientStorage = errors.New("insufficient free disk space")
+
+// StorageWatchdogEvent是存储看门狗交给原生平台的事件
+type StorageWatchdogEvent struct {
+	Type         string // 见StorageWatchdogEvent*常量
+	Level        string // 当前的等级，见StorageLevel*常量，full时节点无法获取新的内容
+	FreeBytes    int64  // 仓库所在文件系统的剩余字节数
+	TotalBytes   int64  // 仓库所在文件系统的总字节数
+	GCRemoved    int64  // 垃圾回收删除的块数量，只用于gc事件
+	GCFreedBytes int64  // 垃圾回收释放的仓库字节数，只用于gc事件
+}
+
+// StorageWatchdogListener由原生平台实现，用于在剩余空间不足时提醒用户
+// 事件在看门狗的goroutine上按顺序回调
+type StorageWatchdogListener interface {
+	HandleStorageWatchdogEvent(e *StorageWatchdogEvent)
+}
+
+// StorageWatchdogConfig保存存储看门狗的检查间隔和阈值
+// 阈值是仓库所在文件系统的剩余字节数，为0时不启用该等级
+type StorageWatchdogConfig struct {
+	interval             time.Duration
+	gcThreshold          int64
+	rejectAddsThreshold  int64
+	blockWritesThreshold int64
+}
+
+// NewStorageWatchdogConfig创建默认配置: 每分钟检查一次，剩余空间低于1GB时垃圾回收，
+// 低于512MB时拒绝添加内容，低于256MB时不再保存新的块
+func NewStorageWatchdogConfig() *StorageWatchdogConfig {
+	return &StorageWatchdogConfig{
+		interval:             defaultWatchdogInterval,
+		gcThreshold:          defaultGCThreshold,
+		rejectAddsThreshold:  defaultRejectAddsThreshold,
+		blockWritesThreshold: defaultBlockWritesThreshold,
+	}
+}
+
+// SetInterval设置检查间隔，单位为毫秒，小于等于0时使用默认值(1分钟)
+func (c *StorageWatchdogConfig) SetInterval(intervalMs int64) {
+	if intervalMs <= 0 {
+		c.interval = defaultWatchdogInterval
+		return
+	}
+
+	c.interval = time.Duration(intervalMs) * time.Millisecond
+}
+
+// SetGCThreshold设置触发垃圾回收的剩余字节数
+func (c *StorageWatchdogConfig) SetGCThreshold(bytes int64) {
+	c.gcThreshold = bytes
+}
+
+// SetRejectAddsThreshold设置拒绝添加内容的剩余字节数
+func (c *StorageWatchdogConfig) SetRejectAddsThreshold(bytes int64) {
+	c.rejectAddsThreshold = bytes
+}
+
+// SetBlockWritesThreshold设置不再保存新块的剩余字节数
+func (c *StorageWatchdogConfig) SetBlockWritesThreshold(bytes int64) {
+	c.blockWritesThreshold = bytes
+}
+
+// validate确认阈值按照从宽到严的顺序设置
+func (c *StorageWatchdogConfig) validate() error {
+	if c.blockWritesThreshold < 0 || c.rejectAddsThreshold < 0 || c.gcThreshold < 0 {
+		return fmt.Errorf("storage watchdog thresholds cannot be negative")
+	}
+
+	if c.blockWritesThreshold > c.rejectAddsThreshold || c.rejectAddsThreshold > c.gcThreshold {
+		return fmt.Errorf("storage watchdog thresholds must satisfy block writes <= reject adds <= gc")
+	}
+
+	return nil
+}
+
+// level返回剩余free个字节时的等级
+func (c *StorageWatchdogConfig) level(free int64) string {
+	switch {
+	case free < c.blockWritesThreshold:
+		return StorageLevelFull
+	case free < c.rejectAddsThreshold:
+		return StorageLevelCritical
+	case free < c.gcThreshold:
+		return StorageLevelLow
+	default:
+		return StorageLevelOK
+	}
+}
+
+// localWritesKey是标记应用发起的写入的上下文键
+type localWritesKey struct{}
+
+// withLocalWrites标记由应用发起的写入(添加内容、命令接口、网关)，critical等级时storageGuard拒绝这些写入
+// bitswap在自己的上下文中保存收到的块，不受影响
+func withLocalWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, localWritesKey{}, true)
+}
+
+func isLocalWrite(ctx context.Context) bool {
+	local, _ := ctx.Value(localWritesKey{}).(bool)
+	return local
+}
+
+// localWritesHandler把HTTP请求中的写入标记为应用发起的写入
+func localWritesHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(withLocalWrites(r.Context())))
+	})
+}
+
+// localWritesOption是标记写入的ServeOption，必须是第一个选项才能覆盖所有处理器
+func localWritesOption() ipfs_corehttp.ServeOption {
+	return func(_ *ipfs_core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.Handle("/", localWritesHandler(childMux))
+		return childMux, nil
+	}
+}
+
+// storageWatchdog是一个运行中的看门狗
+type storageWatchdog struct {
+	cancel   context.CancelFunc
+	path     string
+	cfg      *StorageWatchdogConfig
+	listener StorageWatchdogListener
+	level    string // 最近一次检查的等级，由Node.muWatchdog保护
+}
+
+// StartStorageWatchdog启动存储看门狗，替换之前启动的看门狗，cfg为nil时使用默认配置
+// 看门狗定期检查仓库所在文件系统的剩余空间，低于阈值时触发垃圾回收、拒绝添加内容、
+// 停止保存通过bitswap收到的新块，等级变化时通知listener(可以为nil)
+// 启动时会立即检查一次，内存仓库不支持看门狗
+func (n *Node) StartStorageWatchdog(cfg *StorageWatchdogConfig, listener StorageWatchdogListener) error {
+	if cfg == nil {
+		cfg = NewStorageWatchdogConfig()
+	}
+
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	path := n.repo.mr.Path()
+	if path == "" {
+		return fmt.Errorf("memory repo has no filesystem to watch")
+	}
+
+	// 确认平台支持获取剩余空间
+	if _, _, err := diskSpace(path); err != nil {
+		return fmt.Errorf("unable to get free disk space: %w", err)
+	}
+
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("node is closed")
+	}
+
+	// 复制配置，启动后修改cfg不会影响看门狗
+	c := *cfg
+	n.startStorageWatchdog(path, &c, listener, "")
+
+	return nil
+}
+
+// StopStorageWatchdog停止存储看门狗并解除写入限制，没有运行时不做任何事
+// 返回前会等待看门狗触发的垃圾回收结束
+func (n *Node) StopStorageWatchdog() {
+	if n.pauseStorageWatchdog() == nil {
+		return
+	}
+
+	n.storage.apply(StorageLevelOK)
+}
+
+// startStorageWatchdog启动看门狗并停止之前的看门狗，level是上次检查的等级
+func (n *Node) startStorageWatchdog(path string, cfg *StorageWatchdogConfig, listener StorageWatchdogListener, level string) {
+	ctx, cancel := context.WithCancel(n.ctx)
+	w := &storageWatchdog{
+		cancel:   cancel,
+		path:     path,
+		cfg:      cfg,
+		listener: listener,
+		level:    level,
+	}
+
+	n.muWatchdog.Lock()
+	if n.watchdog != nil {
+		n.watchdog.cancel()
+	}
+	n.watchdog = w
+	n.muWatchdog.Unlock()
+
+	go n.runStorageWatchdog(ctx, w)
+}
+
+// pauseStorageWatchdog在重建或关闭IpfsMobile之前停止看门狗，保留写入限制，没有运行时返回nil
+// 返回前等待看门狗触发的垃圾回收结束，之后runGC会因为上下文已取消而直接返回
+// 只等待垃圾回收而不等待看门狗的goroutine，监听器的回调中可以调用GoOffline、Close等方法
+func (n *Node) pauseStorageWatchdog() *storageWatchdog {
+	n.muWatchdog.Lock()
+	w := n.watchdog
+	n.watchdog = nil
+	n.muWatchdog.Unlock()
+
+	if w == nil {
+		return nil
+	}
+
+	w.cancel()
+
+	// 等待正在运行的垃圾回收结束
+	n.muGC.Lock()
+	n.muGC.Unlock()
+
+	return w
+}
+
+// resumeStorageWatchdog使用相同的配置和上次检查的等级重新启动暂停的看门狗，w为nil时不做任何事
+func (n *Node) resumeStorageWatchdog(w *storageWatchdog) {
+	if w == nil || n.ctx.Err() != nil {
+		return
+	}
+
+	n.muWatchdog.Lock()
+	level := w.level
+	n.muWatchdog.Unlock()
+
+	n.startStorageWatchdog(w.path, w.cfg, w.listener, level)
+}
+
+// runStorageWatchdog在ctx取消前定期检查剩余空间
+func (n *Node) runStorageWatchdog(ctx context.Context, w *storageWatchdog) {
+	logger := n.logger.Named("watchdog")
+	ticker := time.NewTicker(w.cfg.interval)
+	defer ticker.Stop()
+
+	emit := func(e *StorageWatchdogEvent) {
+		if w.listener != nil && ctx.Err() == nil {
+			w.listener.HandleStorageWatchdogEvent(e)
+		}
+	}
+
+	n.muWatchdog.Lock()
+	level := w.level
+	n.muWatchdog.Unlock()
+
+	for {
+		free, total, err := diskSpace(w.path)
+		if err != nil {
+			logger.Warn("unable to get free disk space", zap.Error(err))
+		} else {
+			level = n.updateStorageLevel(ctx, w.cfg, w.path, level, free, total, emit)
+
+			n.muWatchdog.Lock()
+			w.level = level
+			n.muWatchdog.Unlock()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// updateStorageLevel应用剩余空间对应的等级，等级变差时先运行垃圾回收再重新检查
+// 返回新的等级
+func (n *Node) updateStorageLevel(ctx context.Context, cfg *StorageWatchdogConfig, path string, prev string, free int64, total int64, emit func(e *StorageWatchdogEvent)) string {
+	logger := n.logger.Named("watchdog")
+	level := cfg.level(free)
+
+	// 只在等级变差时回收，避免剩余空间一直不足时反复遍历块存储
+	if level != StorageLevelOK && storageLevelRank(level) > storageLevelRank(prev) {
+		logger.Info("free disk space is low, running garbage collection", zap.String("level", level), zap.Int64("free", free))
+
+		res, err := n.runGC(ctx, nil)
+		if err != nil {
+			logger.Warn("garbage collection failed", zap.Error(err))
+		}
+
+		if res != nil {
+			if f, t, err := diskSpace(path); err == nil {
+				free, total = f, t
+				level = cfg.level(free)
+			}
+
+			emit(&StorageWatchdogEvent{
+				Type:         StorageWatchdogEventGC,
+				Level:        level,
+				FreeBytes:    free,
+				TotalBytes:   total,
+				GCRemoved:    res.Removed,
+				GCFreedBytes: res.FreedBytes,
+			})
+		}
+	}
+
+	// 与StopStorageWatchdog互斥，停止后不再设置写入限制
+	n.muWatchdog.Lock()
+	if ctx.Err() != nil {
+		n.muWatchdog.Unlock()
+		return prev
+	}
+	n.storage.apply(level)
+	n.muWatchdog.Unlock()
+
+	if level != prev {
+		logger.Info("storage level changed", zap.String("from", prev), zap.String("to", level), zap.Int64("free", free))
+		emit(&StorageWatchdogEvent{
+			Type:       StorageWatchdogEventLevel,
+			Level:      level,
+			FreeBytes:  free,
+			TotalBytes: total,
+		})
+	}
+
+	return level
+}
+
+// storageLevelRank返回等级的严重程度，未知的等级(包括首次检查前的空等级)为0
+func storageLevelRank(level string) int {
+	switch level {
+	case StorageLevelLow:
+		return 1
+	case StorageLevelCritical:
+		return 2
+	case StorageLevelFull:
+		return 3
+	default:
+		return 0
+	}
+}
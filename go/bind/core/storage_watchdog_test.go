@@ -0,0 +1,225 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+type testWatchdogListener struct {
+	events chan *StorageWatchdogEvent
+}
+
+func newTestWatchdogListener() *testWatchdogListener {
+	return &testWatchdogListener{events: make(chan *StorageWatchdogEvent, 16)}
+}
+
+func (l *testWatchdogListener) HandleStorageWatchdogEvent(e *StorageWatchdogEvent) {
+	l.events <- e
+}
+
+// waitLevel等待等级变为level的事件
+func (l *testWatchdogListener) waitLevel(t *testing.T, level string) {
+	t.Helper()
+
+	waitFor(t, "storage level "+level, func() bool {
+		select {
+		case e := <-l.events:
+			return e.Type == StorageWatchdogEventLevel && e.Level == level
+		default:
+			return false
+		}
+	})
+}
+
+// testWatchdogConfig返回使当前剩余空间处于level等级的配置
+func testWatchdogConfig(level string) *StorageWatchdogConfig {
+	const huge = 1 << 62
+
+	cfg := NewStorageWatchdogConfig()
+	cfg.SetBlockWritesThreshold(0)
+	cfg.SetRejectAddsThreshold(0)
+	cfg.SetGCThreshold(0)
+
+	switch level {
+	case StorageLevelFull:
+		cfg.SetBlockWritesThreshold(huge)
+		fallthrough
+	case StorageLevelCritical:
+		cfg.SetRejectAddsThreshold(huge)
+		fallthrough
+	case StorageLevelLow:
+		cfg.SetGCThreshold(huge)
+	}
+
+	return cfg
+}
+
+func TestStorageWatchdogConfig(t *testing.T) {
+	cfg := NewStorageWatchdogConfig()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for free, want := range map[int64]string{
+		2 << 30:   StorageLevelOK,
+		768 << 20: StorageLevelLow,
+		384 << 20: StorageLevelCritical,
+		128 << 20: StorageLevelFull,
+	} {
+		if got := cfg.level(free); got != want {
+			t.Errorf("level(%d) = %q, want %q", free, got, want)
+		}
+	}
+
+	cfg.SetRejectAddsThreshold(2 << 30)
+	if err := cfg.validate(); err == nil {
+		t.Fatal("reject adds threshold above the gc threshold should be invalid")
+	}
+
+	cfg = NewStorageWatchdogConfig()
+	cfg.SetBlockWritesThreshold(-1)
+	if err := cfg.validate(); err == nil {
+		t.Fatal("negative threshold should be invalid")
+	}
+}
+
+func TestStorageGuardCheckPut(t *testing.T) {
+	ctx := context.Background()
+	d := ds.NewMapDatastore()
+	existing := blocksPrefix.ChildString("EXISTING")
+	if err := d.Put(ctx, existing, []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	newKey := blocksPrefix.ChildString("NEW")
+	other := ds.NewKey("/pins/NEW")
+
+	g := &storageGuard{}
+	g.apply(StorageLevelCritical)
+	if err := g.checkPut(ctx, d, newKey, 5); err != nil {
+		t.Fatalf("critical level rejected a block from the network: %v", err)
+	}
+	if err := g.checkPut(withLocalWrites(ctx), d, newKey, 5); !errors.Is(err, errInsufficientStorage) {
+		t.Fatalf("critical level accepted a local write: %v", err)
+	}
+
+	g.apply(StorageLevelFull)
+	if err := g.checkPut(ctx, d, newKey, 5); !errors.Is(err, errInsufficientStorage) {
+		t.Fatalf("full level accepted a new block: %v", err)
+	}
+	if err := g.checkPut(withLocalWrites(ctx), d, existing, 5); err != nil {
+		t.Fatalf("full level rejected re-writing an existing block: %v", err)
+	}
+	if err := g.checkPut(ctx, d, other, 5); err != nil {
+		t.Fatalf("full level rejected a key outside the blockstore: %v", err)
+	}
+
+	g.apply(StorageLevelOK)
+	if err := g.checkPut(withLocalWrites(ctx), d, newKey, 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStorageWatchdogLevels(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	listener := newTestWatchdogListener()
+	if err := n.StartStorageWatchdog(testWatchdogConfig(StorageLevelCritical), listener); err != nil {
+		t.Fatal(err)
+	}
+	listener.waitLevel(t, StorageLevelCritical)
+
+	if _, err := n.AddBytes(randomBytes(t, 1024), true); !errors.Is(err, errInsufficientStorage) {
+		t.Fatalf("AddBytes at the critical level: %v", err)
+	}
+	_, err := n.NewRequest("add").BodyBytes(randomBytes(t, 1024)).Send()
+	if err == nil || !strings.Contains(err.Error(), errInsufficientStorage.Error()) {
+		t.Fatalf("add command at the critical level: %v", err)
+	}
+
+	// 切换在线状态后看门狗和写入限制保持不变
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.AddBytes(randomBytes(t, 1024), true); !errors.Is(err, errInsufficientStorage) {
+		t.Fatalf("AddBytes after going offline: %v", err)
+	}
+	n.muWatchdog.Lock()
+	running := n.watchdog != nil
+	n.muWatchdog.Unlock()
+	if !running {
+		t.Fatal("watchdog not restarted after going offline")
+	}
+
+	if err := n.StartStorageWatchdog(testWatchdogConfig(StorageLevelOK), listener); err != nil {
+		t.Fatal(err)
+	}
+	listener.waitLevel(t, StorageLevelOK)
+	if _, err := n.AddBytes(randomBytes(t, 1024), true); err != nil {
+		t.Fatalf("AddBytes at the ok level: %v", err)
+	}
+
+	n.StopStorageWatchdog()
+}
+
+func TestStorageWatchdogFull(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	added, err := n.AddBytes(randomBytes(t, 1024), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := newTestWatchdogListener()
+	if err := n.StartStorageWatchdog(testWatchdogConfig(StorageLevelFull), listener); err != nil {
+		t.Fatal(err)
+	}
+	listener.waitLevel(t, StorageLevelFull)
+
+	if _, err := n.NewRequest("add").BodyBytes(randomBytes(t, 1024)).Send(); err == nil {
+		t.Fatal("add command at the full level should fail")
+	}
+	if _, err := n.Cat(added.Cid, 0, 0, 0); err != nil {
+		t.Fatalf("existing content unavailable at the full level: %v", err)
+	}
+
+	n.StopStorageWatchdog()
+	if _, err := n.AddBytes(randomBytes(t, 1024), true); err != nil {
+		t.Fatalf("AddBytes after stopping the watchdog: %v", err)
+	}
+}
+
+func TestStorageWatchdogErrors(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	cfg := NewStorageWatchdogConfig()
+	cfg.SetGCThreshold(-1)
+	if err := n.StartStorageWatchdog(cfg, nil); err == nil {
+		t.Fatal("invalid config should fail")
+	}
+
+	r, err := NewMemoryRepo(newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewNode(r, nil)
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.StartStorageWatchdog(nil, nil); err == nil {
+		t.Fatal("memory repo should not support the watchdog")
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.StartStorageWatchdog(nil, nil); err == nil {
+		t.Fatal("closed node should not start the watchdog")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package core
+
+import "golang.org/x/sys/unix"
+
+// diskSpace返回path所在文件系统中当前用户可用的字节数和总字节数
+func diskSpace(path string) (int64, int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	bsize := int64(st.Bsize)
+	return int64(st.Bavail) * bsize, int64(st.Blocks) * bsize, nil
+}
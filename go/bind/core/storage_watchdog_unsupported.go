@@ -0,0 +1,10 @@
+//go:build !unix
+
+package core
+
+import "fmt"
+
+// diskSpace无法在这个平台上获取剩余空间，存储看门狗不可用
+func diskSpace(path string) (int64, int64, error) {
+	return 0, 0, fmt.Errorf("free disk space is not supported on this platform")
+}
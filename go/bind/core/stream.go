@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	p2p_host "github.com/libp2p/go-libp2p/core/host"
+	p2p_network "github.com/libp2p/go-libp2p/core/network"
+	p2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	p2p_protocol "github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// newStreamTimeout是打开新流(包括必要时拨号)的超时时间
+const newStreamTimeout = time.Minute
+
+// StreamHandler由原生平台实现，用于处理远端节点打开的流
+// 每个流在独立的goroutine上回调，处理完毕后必须关闭流
+type StreamHandler interface {
+	HandleStream(s *Stream)
+}
+
+// Stream是暴露给原生平台的libp2p流，可以在TCP、QUIC或BLE邻近传输上使用
+type Stream struct {
+	s p2p_network.Stream
+}
+
+func newStream(s p2p_network.Stream) *Stream {
+	return &Stream{s: s}
+}
+
+// Read读取最多n个字节，返回空数据(nil)表示对端已关闭写入
+func (s *Stream) Read(n int) ([]byte, error) {
+	return readN(s.s, n)
+}
+
+// Write写入数据并返回写入的字节数
+func (s *Stream) Write(data []byte) (int, error) {
+	return s.s.Write(data)
+}
+
+// CloseWrite关闭写入方向，对端读取时会收到结束标记
+func (s *Stream) CloseWrite() error {
+	return s.s.CloseWrite()
+}
+
+// Close关闭流
+func (s *Stream) Close() error {
+	return s.s.Close()
+}
+
+// Reset异常中止流，两端的读写都会立即失败
+func (s *Stream) Reset() error {
+	return s.s.Reset()
+}
+
+// SetDeadline设置读写超时，单位为毫秒，0表示不超时
+func (s *Stream) SetDeadline(timeoutMs int64) error {
+	if timeoutMs <= 0 {
+		return s.s.SetDeadline(time.Time{})
+	}
+
+	return s.s.SetDeadline(time.Now().Add(time.Duration(timeoutMs) * time.Millisecond))
+}
+
+// Protocol返回流使用的协议ID
+func (s *Stream) Protocol() string {
+	return string(s.s.Protocol())
+}
+
+// RemotePeer返回远端节点ID
+func (s *Stream) RemotePeer() string {
+	return s.s.Conn().RemotePeer().String()
+}
+
+// RemoteMultiaddr返回远端节点的多地址
+func (s *Stream) RemoteMultiaddr() string {
+	return s.s.Conn().RemoteMultiaddr().String()
+}
+
+// SetStreamHandler为协议注册流处理器，已注册的处理器会被替换
+// 离线时注册的处理器会在节点上线后生效
+func (n *Node) SetStreamHandler(protocolID string, handler StreamHandler) error {
+	if handler == nil {
+		return fmt.Errorf("handler cannot be nil")
+	}
+
+	n.muStreamHandlers.Lock()
+	defer n.muStreamHandlers.Unlock()
+
+	n.streamHandlers[protocolID] = handler
+	if h := n.mobile().PeerHost(); h != nil {
+		setStreamHandler(h, protocolID, handler)
+	}
+
+	return nil
+}
+
+// RemoveStreamHandler移除协议的流处理器
+func (n *Node) RemoveStreamHandler(protocolID string) {
+	n.muStreamHandlers.Lock()
+	defer n.muStreamHandlers.Unlock()
+
+	delete(n.streamHandlers, protocolID)
+	if h := n.mobile().PeerHost(); h != nil {
+		h.RemoveStreamHandler(p2p_protocol.ID(protocolID))
+	}
+}
+
+// NewStream使用给定协议向远端节点打开新流，必要时会先连接该节点
+func (n *Node) NewStream(peerID string, protocolID string) (*Stream, error) {
+	pid, err := p2p_peer.Decode(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer id `%s`: %w", peerID, err)
+	}
+
+	h := n.mobile().PeerHost()
+	if h == nil {
+		return nil, errNodeOffline
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, newStreamTimeout)
+	defer cancel()
+
+	s, err := h.NewStream(ctx, pid, p2p_protocol.ID(protocolID))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open stream to `%s`: %w", peerID, err)
+	}
+
+	return newStream(s), nil
+}
+
+// applyStreamHandlers在(重新)上线的主机上注册所有流处理器
+func (n *Node) applyStreamHandlers(h p2p_host.Host) {
+	n.muStreamHandlers.Lock()
+	defer n.muStreamHandlers.Unlock()
+
+	for protocolID, handler := range n.streamHandlers {
+		setStreamHandler(h, protocolID, handler)
+	}
+}
+
+func setStreamHandler(h p2p_host.Host, protocolID string, handler StreamHandler) {
+	h.SetStreamHandler(p2p_protocol.ID(protocolID), func(s p2p_network.Stream) {
+		handler.HandleStream(newStream(s))
+	})
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testProtocol = "/test/echo/1.0.0"
+
+// echoHandler把收到的数据原样写回，直到对端关闭写入
+type echoHandler struct{}
+
+func (echoHandler) HandleStream(s *Stream) {
+	defer s.Close()
+
+	for {
+		data, err := s.Read(1024)
+		if err != nil || data == nil {
+			return
+		}
+		if _, err := s.Write(data); err != nil {
+			return
+		}
+	}
+}
+
+func readAll(t *testing.T, s *Stream) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for {
+		data, err := s.Read(1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data == nil {
+			return buf.Bytes()
+		}
+		buf.Write(data)
+	}
+}
+
+// expectStreamError检查打开流或在流上通信失败，协议协商可能延迟到第一次读取时进行
+func expectStreamError(t *testing.T, n *Node, peerID, protocolID string) {
+	t.Helper()
+
+	s, err := n.NewStream(peerID, protocolID)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte("ping")); err != nil {
+		return
+	}
+	if _, err := s.Read(4); err == nil {
+		t.Fatalf("stream for `%s` should fail", protocolID)
+	}
+}
+
+func TestStreamEcho(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+	aID := a.mobile().PeerHost().ID().String()
+	bID := b.mobile().PeerHost().ID().String()
+
+	if err := b.SetStreamHandler(testProtocol, echoHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	connectTestNodes(t, a, b)
+
+	s, err := a.NewStream(bID, testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Protocol() != testProtocol || s.RemotePeer() != bID || s.RemoteMultiaddr() == "" {
+		t.Fatalf("unexpected stream: %s %s %s", s.Protocol(), s.RemotePeer(), s.RemoteMultiaddr())
+	}
+	if err := s.SetDeadline(10000); err != nil {
+		t.Fatal(err)
+	}
+
+	want := randomBytes(t, 4096)
+	if n, err := s.Write(want); err != nil || n != len(want) {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if err := s.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, s); !bytes.Equal(got, want) {
+		t.Fatalf("echoed %d bytes, want %d", len(got), len(want))
+	}
+
+	// 移除处理器后不能再打开该协议的流
+	b.RemoveStreamHandler(testProtocol)
+	expectStreamError(t, a, bID, testProtocol)
+
+	// 离线时注册的处理器在上线后生效
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetStreamHandler(testProtocol, echoHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GoOnline(); err != nil {
+		t.Fatal(err)
+	}
+	connectTestNodes(t, b, a)
+
+	s, err = b.NewStream(aID, testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, s); string(got) != "ping" {
+		t.Fatalf("echoed %q", got)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	a := newTestNode(t, nil)
+	b := newTestNode(t, nil)
+	bID := b.mobile().PeerHost().ID().String()
+
+	if err := a.SetStreamHandler(testProtocol, nil); err == nil {
+		t.Fatal("registering a nil handler should fail")
+	}
+	if _, err := a.NewStream("not-a-peer-id", testProtocol); err == nil {
+		t.Fatal("opening a stream to an invalid peer id should fail")
+	}
+
+	connectTestNodes(t, a, b)
+	expectStreamError(t, a, bID, "/test/unsupported/1.0.0")
+
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.NewStream(bID, testProtocol); err != errNodeOffline {
+		t.Fatalf("NewStream while offline = %v, want %v", err, errNodeOffline)
+	}
+}
@@ -0,0 +1,469 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/bootstrap"
+	ipfs_p2p "github.com/ipfs/kubo/core/node/libp2p"
+	p2p "github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/dual"
+	p2p_config "github.com/libp2p/go-libp2p/config"
+	p2p_connmgr "github.com/libp2p/go-libp2p/core/connmgr"
+	p2p_host "github.com/libp2p/go-libp2p/core/host"
+	p2p_network "github.com/libp2p/go-libp2p/core/network"
+	p2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	p2p_routing "github.com/libp2p/go-libp2p/core/routing"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"go.uber.org/zap"
+)
+
+// 挂起期间连接管理器使用的水位，受保护的节点(如Peering中配置的节点)的连接总是保留
+const (
+	suspendLowWater  = 4 // 修剪后保留的未受保护连接的数量
+	suspendHighWater = 8 // 连接超过这个数量时修剪
+)
+
+// DHT路由表的刷新周期，与go-libp2p-kad-dht的自动刷新相同
+const (
+	dhtRefreshInterval = 10 * time.Minute // 定期刷新路由表的间隔
+	dhtRefreshCheck    = time.Minute      // 检查路由表是否需要刷新的间隔
+	dhtLowPeers        = 10               // WAN路由表中的节点少于这个数量时不等待定期刷新
+)
+
+// suspendSwitch在创建IpfsMobile时接入连接管理器和DHT路由
+// 挂起期间连接管理器使用suspendLowWater和suspendHighWater，路由报告未就绪使reprovider等待，DHT不再刷新路由表
+// 每个IpfsMobile使用自己的suspendSwitch
+type suspendSwitch struct {
+	suspended atomic.Bool
+	trimming  atomic.Bool // 正在修剪连接，避免每个新连接都启动一次修剪
+}
+
+// suspendState记录挂起前的状态，用于恢复
+type suspendState struct {
+	listenAddrs []ma.Multiaddr // swarm监听的地址
+	protected   []p2p_peer.ID  // 挂起时已连接的受保护节点
+	servers     bool           // 挂起时关闭了API和网关的监听器
+	mdns        bool           // 挂起前mDNS服务是否在运行
+}
+
+// Suspend在应用进入后台时暂停网络活动，必须在SetSuspendTimeout设置的时限内完成
+// 暂停reprovider和DHT刷新，把连接管理器的水位降低到很小的值，关闭swarm监听、API和网关监听器以及mDNS，停止周期性引导，
+// 只保留受保护节点和少量其他节点的连接
+// 超过时限时剩下的步骤不再执行并返回错误，节点仍处于挂起状态，Resume会恢复已经完成的步骤
+// 节点离线或已挂起时不做任何事，PubSub订阅和流处理器在挂起期间保持有效
+func (n *Node) Suspend() error {
+	n.muState.Lock()
+	defer n.muState.Unlock()
+
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("node is closed")
+	}
+
+	if n.suspended != nil || !n.IsOnline() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, n.suspendTimeout)
+	defer cancel()
+
+	im := n.mobile()
+	h := im.PeerHost()
+	st := &suspendState{}
+
+	// 先暂停，之后的步骤超时时节点也不会再主动刷新DHT或发布记录
+	n.suspendSwitch.suspended.Store(true)
+	n.suspended = st
+
+	steps := []func(ctx context.Context){
+		func(context.Context) {
+			st.servers = true
+			n.closeListeners()
+		},
+		func(context.Context) {
+			st.mdns = n.mdnsService != nil
+			n.stopMDNS()
+		},
+		func(context.Context) {
+			im.stopBootstrap()
+		},
+		func(context.Context) {
+			st.listenAddrs = closeSwarmListeners(n.logger, h)
+		},
+		func(ctx context.Context) {
+			st.protected = trimConns(ctx, h.Network(), h.ConnManager(), suspendLowWater)
+		},
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("suspend did not complete within %s: %w", n.suspendTimeout, err)
+		}
+		step(ctx)
+	}
+
+	return nil
+}
+
+// Resume在应用回到前台时恢复网络，必须在SetSuspendTimeout设置的时限内完成
+// 重新监听swarm地址，恢复连接管理器的水位、reprovider和DHT刷新，重新启动API、网关和mDNS，重新引导并连接挂起前的受保护节点
+// 无法重新监听swarm地址时节点保持挂起并返回错误，可以再次调用Resume
+// 无法在原来的地址上重新启动API或网关时返回错误，节点已经恢复
+// 节点未挂起时不做任何事
+func (n *Node) Resume() error {
+	n.muState.Lock()
+	defer n.muState.Unlock()
+
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("node is closed")
+	}
+
+	st := n.suspended
+	if st == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, n.suspendTimeout)
+	defer cancel()
+
+	im := n.mobile()
+	h := im.PeerHost()
+
+	if len(st.listenAddrs) > 0 {
+		if err := h.Network().Listen(st.listenAddrs...); err != nil {
+			return fmt.Errorf("unable to listen on swarm addresses: %w", err)
+		}
+	}
+
+	n.suspended = nil
+	n.suspendSwitch.suspended.Store(false)
+
+	var errs []error
+	if st.servers {
+		if err := n.restartServers(im); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if st.mdns {
+		if err := n.startMDNS(im); err != nil {
+			n.logger.Error("unable to restart mdns", zap.Error(err))
+		}
+	}
+
+	if err := im.Bootstrap(bootstrap.DefaultBootstrapConfig); err != nil {
+		n.logger.Error("unable to bootstrap", zap.Error(err))
+	}
+
+	if im.DHT != nil {
+		// 立即刷新挂起期间可能已经过期的路由表
+		if err := im.DHT.Bootstrap(ctx); err != nil {
+			n.logger.Warn("unable to refresh dht", zap.Error(err))
+		}
+	}
+
+	reconnect(ctx, n.logger, h, st.protected)
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("resume did not complete within %s: %w", n.suspendTimeout, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// IsSuspended返回节点是否处于挂起状态
+func (n *Node) IsSuspended() bool {
+	n.muState.Lock()
+	defer n.muState.Unlock()
+
+	return n.suspended != nil
+}
+
+// closeSwarmListeners关闭主机的swarm监听器，返回之前监听的地址
+// 中继(/p2p-circuit)监听器不占用套接字，关闭后无法重新监听，保持不变
+func closeSwarmListeners(logger *zap.Logger, h p2p_host.Host) []ma.Multiaddr {
+	addrs := []ma.Multiaddr{}
+	for _, addr := range h.Network().ListenAddresses() {
+		if _, err := addr.ValueForProtocol(ma.P_CIRCUIT); err != nil {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	sw, ok := h.Network().(interface{ ListenClose(...ma.Multiaddr) })
+	if !ok {
+		logger.Warn("unable to close swarm listeners")
+		return nil
+	}
+
+	sw.ListenClose(addrs...)
+	return addrs
+}
+
+// trimConns断开受保护节点以外的连接，只保留连接管理器中分值最高的keep个节点
+// 返回已连接的受保护节点
+func trimConns(ctx context.Context, nw p2p_network.Network, cm p2p_connmgr.ConnManager, keep int) []p2p_peer.ID {
+	protected := []p2p_peer.ID{}
+	others := []p2p_peer.ID{}
+	for _, p := range nw.Peers() {
+		if cm.IsProtected(p, "") {
+			protected = append(protected, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+
+	value := func(p p2p_peer.ID) int {
+		if info := cm.GetTagInfo(p); info != nil {
+			return info.Value
+		}
+		return 0
+	}
+	sort.SliceStable(others, func(i, j int) bool {
+		return value(others[i]) > value(others[j])
+	})
+
+	for i := keep; i < len(others) && ctx.Err() == nil; i++ {
+		nw.ClosePeer(others[i])
+	}
+
+	return protected
+}
+
+// reconnect并行连接给定的节点，直到全部完成或ctx结束
+func reconnect(ctx context.Context, logger *zap.Logger, h p2p_host.Host, peers []p2p_peer.ID) {
+	var wg sync.WaitGroup
+	for _, p := range peers {
+		if h.Network().Connectedness(p) == p2p_network.Connected {
+			continue
+		}
+
+		wg.Add(1)
+		go func(p p2p_peer.ID) {
+			defer wg.Done()
+			if err := h.Connect(ctx, h.Peerstore().PeerInfo(p)); err != nil {
+				logger.Debug("unable to reconnect to protected peer", zap.Stringer("peer", p), zap.Error(err))
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// connManagerOption用suspendConnMgr包装kubo按照Swarm.ConnMgr创建的连接管理器
+// 必须放在kubo的主机选项之后
+func (s *suspendSwitch) connManagerOption() p2p.Option {
+	return func(cfg *p2p_config.Config) error {
+		inner := cfg.ConnManager
+		if inner == nil {
+			inner = &p2p_connmgr.NullConnMgr{}
+		}
+
+		cm := &suspendConnMgr{ConnManager: inner, sw: s}
+		if d, ok := p2p_connmgr.SupportsDecay(inner); ok {
+			cfg.ConnManager = &suspendDecayConnMgr{suspendConnMgr: cm, decayer: d}
+		} else {
+			cfg.ConnManager = cm
+		}
+
+		return nil
+	}
+}
+
+// routingOption按照仓库配置的Routing.Type创建路由，routingType为"none"时不使用DHT
+// DHT与kubo的DHTOption相同，但关闭了自动刷新，由refreshDHT在节点未挂起时刷新路由表
+// 绑定层没有委托路由，"auto"和"autoclient"分别与"dht"和"dhtclient"相同
+func (s *suspendSwitch) routingOption(routingType string) (ipfs_p2p.RoutingOption, error) {
+	var mode dht.ModeOpt
+	switch routingType {
+	case "none":
+		return ipfs_p2p.NilRouterOption, nil
+	case "auto", "dht":
+		mode = dht.ModeAuto
+	case "autoclient", "dhtclient":
+		mode = dht.ModeClient
+	case "dhtserver":
+		mode = dht.ModeServer
+	default:
+		return nil, fmt.Errorf("unsupported routing type `%s`", routingType)
+	}
+
+	return func(args ipfs_p2p.RoutingOptionArgs) (p2p_routing.Routing, error) {
+		dhtOpts := []dht.Option{
+			dht.Concurrency(10),
+			dht.Mode(mode),
+			dht.Datastore(args.Datastore),
+			dht.Validator(args.Validator),
+			dht.DisableAutoRefresh(),
+		}
+		if args.OptimisticProvide {
+			dhtOpts = append(dhtOpts, dht.EnableOptimisticProvide())
+		}
+		if args.OptimisticProvideJobsPoolSize != 0 {
+			dhtOpts = append(dhtOpts, dht.OptimisticProvideJobsPoolSize(args.OptimisticProvideJobsPoolSize))
+		}
+
+		lanOpts := []dht.Option{}
+		if args.LoopbackAddressesOnLanDHT {
+			lanOpts = append(lanOpts, dht.AddressFilter(nil))
+		}
+
+		d, err := dual.New(
+			args.Ctx, args.Host,
+			dual.DHTOption(dhtOpts...),
+			dual.WanDHTOption(dht.BootstrapPeers(args.BootstrapPeers...)),
+			dual.LanDHTOption(lanOpts...),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		go s.refreshDHT(args.Ctx, d)
+
+		return newSuspendRouting(d, s), nil
+	}, nil
+}
+
+// refreshDHT代替DHT的自动刷新，挂起期间不刷新，直到ctx结束(节点关闭)
+func (s *suspendSwitch) refreshDHT(ctx context.Context, d *dual.DHT) {
+	ticker := time.NewTicker(dhtRefreshCheck)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if s.suspended.Load() {
+			continue
+		}
+
+		periodic := time.Since(last) >= dhtRefreshInterval
+		if periodic {
+			last = time.Now()
+		}
+
+		// 刷新的结果由DHT记录日志，这里不需要等待
+		if periodic || d.WAN.RoutingTable().Size() < dhtLowPeers {
+			d.WAN.RefreshRoutingTable()
+		}
+		if periodic {
+			d.LAN.RefreshRoutingTable()
+		}
+	}
+}
+
+// trimIfNeeded在挂起期间连接超过suspendHighWater时在后台修剪到suspendLowWater
+func (s *suspendSwitch) trimIfNeeded(nw p2p_network.Network, cm p2p_connmgr.ConnManager) {
+	if !s.suspended.Load() || len(nw.Peers()) <= suspendHighWater {
+		return
+	}
+
+	if !s.trimming.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer s.trimming.Store(false)
+		trimConns(context.Background(), nw, cm, suspendLowWater)
+	}()
+}
+
+// suspendConnMgr包装kubo创建的连接管理器，挂起期间按照suspendLowWater和suspendHighWater修剪连接
+// 未挂起时由被包装的连接管理器按照Swarm.ConnMgr的水位管理连接
+type suspendConnMgr struct {
+	p2p_connmgr.ConnManager
+	sw *suspendSwitch
+}
+
+// Notifee在被包装的连接管理器的通知之后检查挂起期间的连接数量
+func (c *suspendConnMgr) Notifee() p2p_network.Notifiee {
+	return &suspendNotifiee{Notifiee: c.ConnManager.Notifee(), sw: c.sw, cm: c}
+}
+
+// suspendDecayConnMgr在被包装的连接管理器支持衰减标签时使用，gossipsub通过衰减标签标记节点
+type suspendDecayConnMgr struct {
+	*suspendConnMgr
+	decayer p2p_connmgr.Decayer
+}
+
+func (c *suspendDecayConnMgr) RegisterDecayingTag(name string, interval time.Duration, decayFn p2p_connmgr.DecayFn, bumpFn p2p_connmgr.BumpFn) (p2p_connmgr.DecayingTag, error) {
+	return c.decayer.RegisterDecayingTag(name, interval, decayFn, bumpFn)
+}
+
+func (c *suspendDecayConnMgr) Notifee() p2p_network.Notifiee {
+	return &suspendNotifiee{Notifiee: c.ConnManager.Notifee(), sw: c.sw, cm: c}
+}
+
+// suspendNotifiee转发连接通知，并在新连接建立后检查是否需要修剪
+type suspendNotifiee struct {
+	p2p_network.Notifiee
+	sw *suspendSwitch
+	cm p2p_connmgr.ConnManager // 外层的连接管理器
+}
+
+func (nn *suspendNotifiee) Connected(nw p2p_network.Network, conn p2p_network.Conn) {
+	nn.Notifiee.Connected(nw, conn)
+	nn.sw.trimIfNeeded(nw, nn.cm)
+}
+
+// suspendRouting包装DHT，挂起期间报告未就绪，reprovider会等待就绪后再发布记录，而不是在没有网络时反复失败
+type suspendRouting struct {
+	p2p_routing.Routing
+	sw *suspendSwitch
+}
+
+// provideMany是支持批量发布的路由(见boxo/provider.ProvideMany)
+type provideMany interface {
+	ProvideMany(ctx context.Context, keys []multihash.Multihash) error
+}
+
+// suspendProvideManyRouting是被包装的路由支持批量发布时使用的suspendRouting
+// reprovider通过类型断言检查批量发布，包装时必须保留这个能力
+type suspendProvideManyRouting struct {
+	*suspendRouting
+	pm provideMany
+}
+
+func (r *suspendProvideManyRouting) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	return r.pm.ProvideMany(ctx, keys)
+}
+
+func newSuspendRouting(inner p2p_routing.Routing, sw *suspendSwitch) p2p_routing.Routing {
+	r := &suspendRouting{Routing: inner, sw: sw}
+	if pm, ok := inner.(provideMany); ok {
+		return &suspendProvideManyRouting{suspendRouting: r, pm: pm}
+	}
+
+	return r
+}
+
+// Ready在挂起期间返回false，否则返回被包装的路由是否就绪
+func (r *suspendRouting) Ready() bool {
+	if r.sw.suspended.Load() {
+		return false
+	}
+
+	if rr, ok := r.Routing.(interface{ Ready() bool }); ok {
+		return rr.Ready()
+	}
+
+	return true
+}
+
+// Routers返回被包装的路由，kubo通过它找到DHT实例(IpfsNode.DHT)并在节点关闭时关闭DHT
+func (r *suspendRouting) Routers() []p2p_routing.Routing {
+	if cr, ok := r.Routing.(interface{ Routers() []p2p_routing.Routing }); ok {
+		return cr.Routers()
+	}
+
+	return []p2p_routing.Routing{r.Routing}
+}
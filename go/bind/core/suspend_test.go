@@ -0,0 +1,247 @@
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	p2p_host "github.com/libp2p/go-libp2p/core/host"
+	p2p_network "github.com/libp2p/go-libp2p/core/network"
+	p2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	p2p_routing "github.com/libp2p/go-libp2p/core/routing"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestSuspendResume(t *testing.T) {
+	n := newTestNode(t, nil)
+	im := n.mobile()
+	h := im.PeerHost()
+
+	if _, ok := h.ConnManager().(*suspendDecayConnMgr); !ok {
+		t.Fatalf("connection manager is not wrapped: %T", h.ConnManager())
+	}
+	if im.DHT == nil {
+		t.Fatal("kubo did not find the DHT behind the suspendable routing")
+	}
+
+	gw, err := n.ServeGateway("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := h.Network().ListenAddresses()
+	if len(addrs) < 2 {
+		t.Fatal("node is not listening")
+	}
+
+	if err := n.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if !n.IsSuspended() {
+		t.Fatal("node is not suspended")
+	}
+	if got := h.Network().ListenAddresses(); len(got) != 1 || got[0].String() != "/p2p-circuit" {
+		t.Fatalf("swarm is still listening on %v", got)
+	}
+	if (&suspendRouting{sw: n.suspendSwitch}).Ready() {
+		t.Fatal("routing is ready while suspended, reprovider is not paused")
+	}
+	if im.Bootstrapper != nil {
+		t.Fatal("bootstrap is still running")
+	}
+
+	// 已挂起时不做任何事
+	if err := n.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if n.IsSuspended() {
+		t.Fatal("node is still suspended")
+	}
+	if len(h.Network().ListenAddresses()) != len(addrs) {
+		t.Fatalf("swarm listen addresses not restored: %v, was %v", h.Network().ListenAddresses(), addrs)
+	}
+	if n.suspendSwitch.suspended.Load() {
+		t.Fatal("connection manager and routing are still suspended")
+	}
+
+	ga, err := ma.NewMultiaddr(gw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := ga.ValueForProtocol(ma.P_IP4)
+	port, _ := ga.ValueForProtocol(ma.P_TCP)
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		t.Fatalf("gateway not restarted: %v", err)
+	}
+	conn.Close()
+}
+
+func TestResumeListenFailure(t *testing.T) {
+	n := newTestNode(t, nil)
+
+	if err := n.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 挂起期间原来的地址被占用
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/" + portOf(l.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.suspended.listenAddrs = []ma.Multiaddr{addr}
+
+	if err := n.Resume(); err == nil {
+		t.Fatal("resume should fail when swarm addresses cannot be listened on")
+	}
+	if !n.IsSuspended() || !n.suspendSwitch.suspended.Load() {
+		t.Fatal("node should stay suspended after a failed resume")
+	}
+
+	l.Close()
+	if err := n.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if n.IsSuspended() {
+		t.Fatal("node is still suspended")
+	}
+}
+
+func TestSuspendOfflineNode(t *testing.T) {
+	n := newTestNode(t, nil)
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if n.IsSuspended() {
+		t.Fatal("an offline node should not be suspended")
+	}
+
+	n.Close()
+	if err := n.Suspend(); err == nil {
+		t.Fatal("suspending a closed node should fail")
+	}
+}
+
+func TestTrimConnsKeepsProtected(t *testing.T) {
+	a := newTestNode(t, nil).mobile().PeerHost()
+	b := newTestNode(t, nil).mobile().PeerHost()
+	c := newTestNode(t, nil).mobile().PeerHost()
+
+	ctx := context.Background()
+	for _, p := range []p2p_host.Host{b, c} {
+		if err := a.Connect(ctx, p2p_peer.AddrInfo{ID: p.ID(), Addrs: p.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a.ConnManager().Protect(b.ID(), "test")
+	protected := trimConns(ctx, a.Network(), a.ConnManager(), 0)
+
+	if len(protected) != 1 || protected[0] != b.ID() {
+		t.Fatalf("unexpected protected peers: %v", protected)
+	}
+	if a.Network().Connectedness(b.ID()) != p2p_network.Connected {
+		t.Fatal("protected peer was disconnected")
+	}
+	if a.Network().Connectedness(c.ID()) == p2p_network.Connected {
+		t.Fatal("unprotected peer is still connected")
+	}
+}
+
+func TestRoutingType(t *testing.T) {
+	for _, c := range []struct {
+		routingType string
+		mode        dht.ModeOpt
+	}{
+		{"dht", dht.ModeAuto},
+		{"dhtclient", dht.ModeClient},
+		{"autoclient", dht.ModeClient},
+		{"dhtserver", dht.ModeServer},
+	} {
+		cfg := newTestConfig(t)
+		if err := cfg.SetKey("Routing.Type", []byte(`"`+c.routingType+`"`)); err != nil {
+			t.Fatal(err)
+		}
+
+		n := newTestNode(t, cfg)
+		d := n.mobile().DHT
+		if d == nil {
+			t.Fatalf("Routing.Type %s: no DHT", c.routingType)
+		}
+		if got := d.WAN.Mode(); got != c.mode {
+			t.Errorf("Routing.Type %s: DHT mode = %v, want %v", c.routingType, got, c.mode)
+		}
+	}
+
+	cfg := newTestConfig(t)
+	if err := cfg.SetKey("Routing.Type", []byte(`"none"`)); err != nil {
+		t.Fatal(err)
+	}
+	if n := newTestNode(t, cfg); n.mobile().DHT != nil {
+		t.Fatal("Routing.Type none: DHT was built")
+	}
+
+	cfg = newTestConfig(t)
+	if err := cfg.SetKey("Routing.Type", []byte(`"custom"`)); err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir()
+	if err := InitRepo(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := NewNode(r, nil); err == nil {
+		t.Fatal("starting a node with an unsupported routing type should fail")
+	}
+}
+
+// testProvideManyRouting是支持批量发布的路由
+type testProvideManyRouting struct {
+	p2p_routing.Routing
+	keys int
+}
+
+func (r *testProvideManyRouting) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	r.keys += len(keys)
+	return nil
+}
+
+func TestSuspendRoutingProvideMany(t *testing.T) {
+	sw := &suspendSwitch{}
+
+	if _, ok := newSuspendRouting(&testProvideManyRouting{}, sw).(provideMany); !ok {
+		t.Fatal("ProvideMany hidden by the suspend wrapper")
+	}
+	if _, ok := newSuspendRouting(p2p_routing.Routing(nil), sw).(provideMany); ok {
+		t.Fatal("ProvideMany exposed for a router without it")
+	}
+
+	inner := &testProvideManyRouting{}
+	r := newSuspendRouting(inner, sw).(provideMany)
+	if err := r.ProvideMany(context.Background(), []multihash.Multihash{nil, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if inner.keys != 2 {
+		t.Fatalf("forwarded %d keys", inner.keys)
+	}
+}
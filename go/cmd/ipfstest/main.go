@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -20,15 +21,23 @@ func main() {
 	// 处理系统信号，以便优雅地关闭
 	setupSignalHandler(cancel)
 
+	// -memory使用内存仓库，退出后不会留下仓库目录
+	memory := flag.Bool("memory", false, "使用内存仓库，不写入磁盘")
+	flag.Parse()
+
 	// 定义仓库路径
 	repoPath := filepath.Join(".", "ipfs_repo_test")
 
 	// 打印欢迎信息
 	fmt.Println("===== IPFS节点测试程序 =====")
-	fmt.Printf("仓库路径: %s\n", repoPath)
+	if *memory {
+		fmt.Println("仓库路径: 内存")
+	} else {
+		fmt.Printf("仓库路径: %s\n", repoPath)
+	}
 
 	// 初始化或打开仓库
-	repo, err := initOrOpenRepo(repoPath)
+	repo, err := initOrOpenRepo(repoPath, *memory)
 	if err != nil {
 		fmt.Printf("初始化/打开仓库失败: %s\n", err)
 		os.Exit(1)
@@ -48,7 +57,7 @@ func main() {
 
 	// 创建并启动IPFS节点
 	fmt.Println("正在启动IPFS节点...")
-	ipfsMobile, err := core.NewNode(ctx, ipfsConfig)
+	ipfsMobile, err := core.NewIpfsMobile(ctx, ipfsConfig)
 	if err != nil {
 		fmt.Printf("启动节点失败: %s\n", err)
 		os.Exit(1)
@@ -77,7 +86,11 @@ func main() {
 }
 
 // 初始化或打开IPFS仓库
-func initOrOpenRepo(repoPath string) (*core.Repo, error) {
+func initOrOpenRepo(repoPath string, memory bool) (*core.Repo, error) {
+	if memory {
+		return core.NewMemoryRepo(nil)
+	}
+
 	// 检查仓库是否已经存在
 	if _, err := os.Stat(filepath.Join(repoPath, "config")); os.IsNotExist(err) {
 		fmt.Println("仓库不存在，正在初始化...")
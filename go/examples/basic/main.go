@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/ipfs/boxo/files"
+	boxo_path "github.com/ipfs/boxo/path"
 	"github.com/ipfs/kubo/core/coreapi"
 	coreiface "github.com/ipfs/kubo/core/coreiface"
 	"github.com/ipfs/kubo/core/coreiface/options"
@@ -19,16 +21,24 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// -memory使用内存仓库，退出后不会留下仓库目录
+	memory := flag.Bool("memory", false, "使用内存仓库，不写入磁盘")
+	flag.Parse()
+
 	// 定义仓库路径
 	repoPath := filepath.Join(".", "ipfs_repo_example")
 
 	// 打印欢迎信息
 	fmt.Println("===== IPFS基本示例程序 =====")
 	fmt.Println("此示例展示如何添加和获取内容")
-	fmt.Printf("仓库路径: %s\n", repoPath)
+	if *memory {
+		fmt.Println("仓库路径: 内存")
+	} else {
+		fmt.Printf("仓库路径: %s\n", repoPath)
+	}
 
 	// 初始化或打开仓库
-	repo, err := initOrOpenRepo(repoPath)
+	repo, err := initOrOpenRepo(repoPath, *memory)
 	if err != nil {
 		fmt.Printf("初始化/打开仓库失败: %s\n", err)
 		os.Exit(1)
@@ -45,7 +55,7 @@ func main() {
 
 	// 创建并启动IPFS节点
 	fmt.Println("正在启动IPFS节点...")
-	ipfsMobile, err := core.NewNode(ctx, ipfsConfig)
+	ipfsMobile, err := core.NewIpfsMobile(ctx, ipfsConfig)
 	if err != nil {
 		fmt.Printf("启动节点失败: %s\n", err)
 		os.Exit(1)
@@ -93,7 +103,11 @@ func main() {
 }
 
 // 初始化或打开IPFS仓库
-func initOrOpenRepo(repoPath string) (*core.Repo, error) {
+func initOrOpenRepo(repoPath string, memory bool) (*core.Repo, error) {
+	if memory {
+		return core.NewMemoryRepo(nil)
+	}
+
 	if _, err := os.Stat(filepath.Join(repoPath, "config")); os.IsNotExist(err) {
 		fmt.Println("仓库不存在，正在初始化...")
 
@@ -126,13 +140,13 @@ func addContent(ctx context.Context, api coreiface.CoreAPI, content string) (str
 		return "", err
 	}
 
-	return path.Cid().String(), nil
+	return path.RootCid().String(), nil
 }
 
 // 从IPFS获取内容
 func getContent(ctx context.Context, api coreiface.CoreAPI, cid string) (string, error) {
 	// 解析路径
-	path, err := coreiface.ParsePath("/ipfs/" + cid)
+	path, err := boxo_path.NewPath("/ipfs/" + cid)
 	if err != nil {
 		return "", err
 	}
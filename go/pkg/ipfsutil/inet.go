@@ -41,7 +41,7 @@ func SetNetDriver(n Net) {
 	muNetDriver.Unlock()
 }
 
-func getNetDriver() (n Net) {
+func GetNetDriver() (n Net) {
 	muNetDriver.RLock()
 	n = netdriver
 	muNetDriver.RUnlock()
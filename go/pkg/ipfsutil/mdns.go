@@ -121,7 +121,7 @@ func (s *mdnsService) Start() error {
 
 func GetMulticastInterfaces() ([]net.Interface, error) {
 	// manually get interfaces list
-	ifaces, err := getNetDriver().Interfaces()
+	ifaces, err := GetNetDriver().Interfaces()
 	if err != nil {
 		return nil, err
 	}